@@ -0,0 +1,674 @@
+package brb
+
+import (
+	"gonum.org/v1/gonum/graph/simple"
+	"math/rand"
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+	"sort"
+)
+
+// SilentAdversary never sends anything, which makes it indistinguishable from a crashed process
+type SilentAdversary struct{}
+
+var _ Adversary = (*SilentAdversary)(nil)
+
+func (s *SilentAdversary) Init(Protocol, Network, Application, Config) {}
+
+func (s *SilentAdversary) Receive(uint8, uint64, uint32, Size) {}
+
+func (s *SilentAdversary) Broadcast(uint32, Size, BroadcastInfo) {}
+
+// destRand gives every destination its own source of randomness derived from one seed, so random choices do not depend
+// on the (map) order in which messages to different destinations are sent
+type destRand struct {
+	seed int64
+	r    map[uint64]*rand.Rand
+}
+
+func newDestRand(cfg Config) destRand {
+	return destRand{seed: cfg.random().Int63(), r: make(map[uint64]*rand.Rand)}
+}
+
+func (d destRand) get(dest uint64) *rand.Rand {
+	r, ok := d.r[dest]
+	if !ok {
+		r = rand.New(rand.NewSource(d.seed ^ int64(dest)))
+		d.r[dest] = r
+	}
+
+	return r
+}
+
+// interceptingAdversary runs the honest protocol, but all outgoing messages pass through intercept first
+type interceptingAdversary struct {
+	honest Protocol
+	cfg    Config
+}
+
+func (a *interceptingAdversary) init(honest Protocol, n Network, app Application, cfg Config,
+	intercept func(messageType uint8, dest uint64, uid uint32, data Size) (Size, bool)) {
+	a.honest = honest
+	a.cfg = cfg
+
+	honest.Init(adversaryNetwork{Network: n, intercept: intercept}, app, cfg)
+}
+
+func (a *interceptingAdversary) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	a.honest.Receive(messageType, src, uid, data)
+}
+
+func (a *interceptingAdversary) Broadcast(uid uint32, payload Size, bc BroadcastInfo) {
+	a.honest.Broadcast(uid, payload, bc)
+}
+
+// RandomDropAdversary behaves honestly, but drops every outgoing message with probability P
+type RandomDropAdversary struct {
+	interceptingAdversary
+	P float64
+
+	rand destRand
+}
+
+var _ Adversary = (*RandomDropAdversary)(nil)
+
+func (r *RandomDropAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	r.rand = newDestRand(cfg)
+	r.init(honest, n, app, cfg, func(_ uint8, dest uint64, _ uint32, data Size) (Size, bool) {
+		return data, r.rand.get(dest).Float64() >= r.P
+	})
+}
+
+// EquivocateAdversary behaves honestly, but splits the processes it sends to in Groups groups (by id) and replaces
+// the payload of all messages with a different payload for every group (except the first). Used as a source, this
+// results in different payloads being broadcast to different subsets of the neighbours.
+type EquivocateAdversary struct {
+	interceptingAdversary
+	Groups uint64
+}
+
+var _ Adversary = (*EquivocateAdversary)(nil)
+
+func (e *EquivocateAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	if e.Groups < 2 {
+		e.Groups = 2
+	}
+
+	e.init(honest, n, app, cfg, func(_ uint8, dest uint64, _ uint32, data Size) (Size, bool) {
+		group := dest % e.Groups
+		if group == 0 {
+			return data, true
+		}
+
+		return mapPayload(data, func(p Size) Size {
+			return EquivocatedPayload{Original: p, Variant: group}
+		}), true
+	})
+}
+
+// SpoofAdversary behaves honestly, but also impersonates the other neighbours of every process it sends to. Every
+// message is sent again as up to Copies (all by default) of those neighbours with an equivocated payload, so accepted
+// forgeries result in violations. Messages can only be forged over a SpoofingNetwork.
+type SpoofAdversary struct {
+	interceptingAdversary
+	Copies int
+}
+
+var _ Adversary = (*SpoofAdversary)(nil)
+
+func (s *SpoofAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	sn, ok := n.(SpoofingNetwork)
+
+	s.init(honest, n, app, cfg, func(messageType uint8, dest uint64, uid uint32, data Size) (Size, bool) {
+		if !ok {
+			return data, true
+		}
+
+		forged := mapPayload(data, func(p Size) Size {
+			return EquivocatedPayload{Original: p, Variant: 1}
+		})
+		for _, src := range s.impersonate(dest) {
+			sn.SendAs(src, messageType, dest, uid, forged)
+		}
+
+		return data, true
+	})
+}
+
+// impersonate returns the neighbours of dest that are impersonated when sending to dest
+func (s *SpoofAdversary) impersonate(dest uint64) []uint64 {
+	var res []uint64
+
+	to := s.cfg.Graph.From(int64(dest))
+	for to.Next() {
+		if n := uint64(to.Node().ID()); n != s.cfg.Id {
+			res = append(res, n)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+
+	if s.Copies > 0 && len(res) > s.Copies {
+		res = res[:s.Copies]
+	}
+
+	return res
+}
+
+// ForgeMode determines how the ForgePathsAdversary rewrites paths
+type ForgeMode int
+
+const (
+	// Replace all intermediate nodes with random nodes, the edges of the path might not exist
+	ForgeInventEdges ForgeMode = iota
+	// Claim the path went through other nodes over existing edges, or over a route planned by the source when
+	// implicit paths (ord7) are used
+	ForgeClaimNodes
+	// Remove the hop towards the Byzantine node from the path
+	ForgeDropHop
+)
+
+// ForgePathsAdversary relays honestly, but rewrites all paths it relays according to Mode in an attempt to make correct
+// processes accept fewer than f+1 truly disjoint paths. Every path is replaced by Copies (f+1 by default) forged paths,
+// and the desired routes are updated accordingly so correct processes will keep relaying the forged paths.
+type ForgePathsAdversary struct {
+	interceptingAdversary
+	Mode   ForgeMode
+	Copies int
+
+	// Replace the payload as well, so a successful forgery results in a validity violation
+	Payload bool
+
+	nodes []uint64
+	rand  destRand
+}
+
+var _ Adversary = (*ForgePathsAdversary)(nil)
+
+func (f *ForgePathsAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	f.nodes, _ = graphs.Nodes(cfg.Graph)
+	f.rand = newDestRand(cfg)
+
+	sort.Slice(f.nodes, func(i, j int) bool {
+		return f.nodes[i] < f.nodes[j]
+	})
+
+	if f.Copies <= 0 {
+		f.Copies = cfg.F + 1
+	}
+
+	f.init(honest, n, app, cfg, func(_ uint8, dest uint64, _ uint32, data Size) (Size, bool) {
+		if f.Payload {
+			data = mapPayload(data, func(p Size) Size {
+				return EquivocatedPayload{Original: p}
+			})
+		}
+
+		return mapPaths(data, func(p algo.DolevPath) []algo.DolevPath {
+			return f.forge(dest, p)
+		}), true
+	})
+}
+
+func (f *ForgePathsAdversary) forge(dest uint64, p algo.DolevPath) []algo.DolevPath {
+	if len(p.Actual) == 0 || len(f.nodes) <= 2 {
+		return []algo.DolevPath{p}
+	}
+
+	res := make([]algo.DolevPath, 0, f.Copies)
+
+	for i := 0; i < f.Copies; i++ {
+		var actual graphs.Path
+
+		switch f.Mode {
+		case ForgeInventEdges:
+			actual = f.invent(f.rand.get(dest), p.Actual)
+		case ForgeClaimNodes:
+			actual = f.claim(p.Actual, dest)
+		case ForgeDropHop:
+			actual = p.Actual[:len(p.Actual)-1]
+		}
+
+		if actual == nil {
+			continue
+		}
+
+		fp := algo.DolevPath{Actual: actual, Prio: p.Prio}
+		if len(p.Desired) > len(p.Actual) {
+			fp.Desired = append(append(make(graphs.Path, 0, len(p.Desired)), actual...), p.Desired[len(p.Actual):]...)
+		}
+
+		res = append(res, fp)
+
+		// Dropping a hop can only be done in one way
+		if f.Mode == ForgeDropHop {
+			break
+		}
+	}
+
+	if len(res) == 0 {
+		return []algo.DolevPath{p}
+	}
+
+	return res
+}
+
+func (f *ForgePathsAdversary) invent(r *rand.Rand, p graphs.Path) graphs.Path {
+	origin, self := uint64(p[0].From().ID()), f.cfg.Id
+	hops := len(p)
+	if hops < 2 {
+		hops = 2
+	}
+
+	res := make(graphs.Path, 0, hops)
+	prev := origin
+
+	for i := 0; i < hops-1; i++ {
+		next := f.nodes[r.Intn(len(f.nodes))]
+		for next == origin || next == self {
+			next = f.nodes[r.Intn(len(f.nodes))]
+		}
+
+		res = append(res, simple.WeightedEdge{F: simple.Node(prev), T: simple.Node(next), W: 1})
+		prev = next
+	}
+
+	return append(res, simple.WeightedEdge{F: simple.Node(prev), T: simple.Node(self), W: 1})
+}
+
+// claim finds a different path from the origin to this process, which is accepted by the next hop. If implicit
+// paths are used, only prefixes of routes planned by the origin are accepted so one of those is used.
+func (f *ForgePathsAdversary) claim(p graphs.Path, dest uint64) graphs.Path {
+	origin := uint64(p[0].From().ID())
+
+	if f.cfg.OptimizationConfig.DolevImplicitPath {
+		var candidates []graphs.Path
+		for _, c := range plannedPrefixes(f.cfg, origin, dest) {
+			if !graphs.IsEqualPath(c, p) {
+				candidates = append(candidates, c)
+			}
+		}
+
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		return candidates[f.rand.get(dest).Intn(len(candidates))]
+	}
+
+	res := walk(f.rand.get(dest), f.cfg.Graph, origin, f.cfg.Id, map[uint64]bool{dest: true}, len(p)+1)
+	if res == nil || graphs.IsEqualPath(res, p) {
+		return nil
+	}
+
+	return res
+}
+
+// plannedPrefixes returns the prefixes (ending at this process) of all routes planned by origin that continue to dest,
+// which are the only paths accepted by dest when implicit paths are used
+func plannedPrefixes(cfg Config, origin, dest uint64) []graphs.Path {
+	t := cfg.Precomputed.FullTable
+	if t == nil {
+		return nil
+	}
+
+	plans := []algo.BroadcastPlan{t.Plan[origin]}
+	for _, bd := range t.BDPlan[origin] {
+		plans = append(plans, bd)
+	}
+
+	var res []graphs.Path
+	for _, plan := range plans {
+		for _, routes := range plan {
+			for _, r := range routes {
+				for i, e := range r.P {
+					if uint64(e.From().ID()) == cfg.Id && uint64(e.To().ID()) == dest {
+						res = append(res, append(make(graphs.Path, 0, i), r.P[:i]...))
+					}
+				}
+			}
+		}
+	}
+
+	// The plans are maps, sorting makes the order (and random choices from it) reproducible
+	sort.Slice(res, func(i, j int) bool {
+		return pathLess(res[i], res[j])
+	})
+
+	return res
+}
+
+// pathLess orders paths by their length and then by the nodes they visit
+func pathLess(a, b graphs.Path) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	for i := range a {
+		if f, g := a[i].From().ID(), b[i].From().ID(); f != g {
+			return f < g
+		}
+
+		if f, g := a[i].To().ID(), b[i].To().ID(); f != g {
+			return f < g
+		}
+	}
+
+	return false
+}
+
+// walk does a random walk over existing edges from s to t of at most maxHops hops, avoiding the given nodes
+func walk(r *rand.Rand, g *simple.WeightedUndirectedGraph, s, t uint64, avoid map[uint64]bool, maxHops int) graphs.Path {
+	visited := map[uint64]bool{s: true}
+	res := make(graphs.Path, 0, maxHops)
+	cur := s
+
+	for cur != t && len(res) < maxHops {
+		var options []uint64
+		to := g.From(int64(cur))
+		for to.Next() {
+			if n := uint64(to.Node().ID()); !visited[n] && !avoid[n] {
+				options = append(options, n)
+			}
+		}
+
+		if len(options) == 0 {
+			return nil
+		}
+
+		// Sorted, so the walk only depends on the random source
+		sort.Slice(options, func(i, j int) bool {
+			return options[i] < options[j]
+		})
+
+		next := options[r.Intn(len(options))]
+		if g.HasEdgeBetween(int64(cur), int64(t)) && len(res) > 0 {
+			next = t
+		}
+
+		visited[next] = true
+		res = append(res, simple.WeightedEdge{F: simple.Node(cur), T: simple.Node(next), W: 1})
+		cur = next
+	}
+
+	if cur != t {
+		return nil
+	}
+
+	return res
+}
+
+// SelectiveRelayAdversary behaves honestly, but only sends messages to a fixed fraction of its neighbours
+type SelectiveRelayAdversary struct {
+	interceptingAdversary
+	Fraction float64
+
+	targets map[uint64]struct{}
+}
+
+var _ Adversary = (*SelectiveRelayAdversary)(nil)
+
+func (s *SelectiveRelayAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	s.targets = make(map[uint64]struct{})
+	for _, i := range cfg.random().Perm(len(cfg.Neighbours))[:int(s.Fraction*float64(len(cfg.Neighbours)))] {
+		s.targets[cfg.Neighbours[i]] = struct{}{}
+	}
+
+	s.init(honest, n, app, cfg, func(_ uint8, dest uint64, _ uint32, data Size) (Size, bool) {
+		_, ok := s.targets[dest]
+		return data, ok
+	})
+}
+
+// ReplayAdversary behaves honestly, but re-sends the messages it sent for earlier broadcasts whenever a new broadcast
+// starts, using the uid of the new broadcast. At most Max old messages are replayed for every new broadcast.
+type ReplayAdversary struct {
+	interceptingAdversary
+	Max int
+
+	n       Network
+	seen    map[uint32]struct{}
+	history []replayEntry
+}
+
+type replayEntry struct {
+	messageType uint8
+	dest        uint64
+	uid         uint32
+	data        Size
+}
+
+var _ Adversary = (*ReplayAdversary)(nil)
+
+func (r *ReplayAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	r.n = n
+	r.seen = make(map[uint32]struct{})
+
+	r.init(honest, n, app, cfg, func(messageType uint8, dest uint64, uid uint32, data Size) (Size, bool) {
+		if len(r.history) < r.Max {
+			r.history = append(r.history, replayEntry{messageType: messageType, dest: dest, uid: uid, data: data})
+		}
+
+		return data, true
+	})
+}
+
+func (r *ReplayAdversary) replay(uid uint32) {
+	if _, ok := r.seen[uid]; ok {
+		return
+	}
+	r.seen[uid] = struct{}{}
+
+	history := r.history
+	r.history = nil
+
+	for _, e := range history {
+		if e.uid != uid {
+			r.n.Send(e.messageType, e.dest, uid, e.data, BroadcastInfo{})
+		}
+	}
+}
+
+func (r *ReplayAdversary) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	r.replay(uid)
+	r.honest.Receive(messageType, src, uid, data)
+}
+
+func (r *ReplayAdversary) Broadcast(uid uint32, payload Size, bc BroadcastInfo) {
+	r.replay(uid)
+	r.honest.Broadcast(uid, payload, bc)
+}
+
+// FakeQuorumAdversary behaves honestly, but forges SEND, ECHO and READY messages for a different payload for every
+// Bracha broadcast it sees, and for a broadcast with the same source that was never sent. All instances forge the same
+// payloads, so their forged messages add up. Works for Bracha and Bracha-Dolev, other protocols are left untouched.
+// With BrachaMinimalSubset (orb2) forged messages are aimed at the processes included for the source, as only they
+// count echoes and only the first 3f+2 of them send readys.
+type FakeQuorumAdversary struct {
+	honest Protocol
+	n      Network
+	cfg    Config
+
+	// Sends a forged message to the given processes, or to all if none are given
+	forge  func(messageType uint8, uid uint32, m BrachaMessage, to []uint64)
+	bracha *BrachaImproved
+	seen   map[brachaIdentifier]struct{}
+}
+
+var _ Adversary = (*FakeQuorumAdversary)(nil)
+
+// Offset of the sequence numbers of forged broadcasts that were never sent
+const fakeQuorumIdOffset = 1 << 24
+
+func (f *FakeQuorumAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	f.honest = honest
+	f.n = n
+	f.cfg = cfg
+	f.seen = make(map[brachaIdentifier]struct{})
+
+	switch h := honest.(type) {
+	case *BrachaImproved:
+		f.bracha = h
+		f.forge = func(messageType uint8, uid uint32, m BrachaMessage, to []uint64) {
+			if to == nil {
+				to = cfg.Neighbours
+			}
+
+			for _, dest := range to {
+				if dest != cfg.Id {
+					n.Send(messageType, dest, uid, m, BroadcastInfo{})
+				}
+			}
+		}
+	case *BrachaDolevKnownImproved:
+		// Observe the Bracha layer, and send forged messages through the Dolev layer
+		f.bracha = &BrachaImproved{}
+		wr := &brachaDolevKnownWrapper{
+			bracha: &fakeQuorumObserver{Protocol: f.bracha, observe: f.observe},
+			dolev:  &DolevKnownImproved{},
+		}
+		h.wr = wr
+
+		f.forge = func(messageType uint8, uid uint32, m BrachaMessage, to []uint64) {
+			w := brachaWrapper{messageType: messageType, msg: m}
+			if to == nil {
+				wr.dolev.Broadcast(uid, w, BroadcastInfo{Type: BrachaEveryone})
+				return
+			}
+
+			for _, dest := range to {
+				if dest != cfg.Id {
+					wr.unicast.Send(uid, dest, w)
+				}
+			}
+		}
+	}
+
+	honest.Init(n, app, cfg)
+}
+
+func (f *FakeQuorumAdversary) observe(_ uint8, uid uint32, data Size) {
+	m, ok := data.(BrachaMessage)
+	if !ok || f.forge == nil {
+		return
+	}
+
+	// Do not forge based on forged messages
+	if _, ok := m.Payload.(EquivocatedPayload); ok {
+		return
+	}
+
+	id := brachaIdentifier{Src: m.Src, Id: m.Id, Hash: MustHash(m.Payload)}
+	if _, ok := f.seen[id]; ok {
+		return
+	}
+	f.seen[id] = struct{}{}
+
+	conflicting := BrachaMessage{Src: m.Src, Id: m.Id, Payload: EquivocatedPayload{Original: m.Payload}}
+	fresh := BrachaMessage{Src: m.Src, Id: m.Id + fakeQuorumIdOffset, Payload: EquivocatedPayload{Original: m.Payload}}
+
+	for _, fm := range []BrachaMessage{conflicting, fresh} {
+		for _, t := range []uint8{BrachaSend, BrachaEcho, BrachaReady} {
+			f.forge(t, uid, fm, f.targets(t, m.Src))
+		}
+	}
+}
+
+// targets returns the processes whose thresholds count a forged message of the source, nil when all of them do
+func (f *FakeQuorumAdversary) targets(messageType uint8, src uint64) []uint64 {
+	if !f.cfg.OptimizationConfig.BrachaMinimalSubset {
+		return nil
+	}
+
+	included := f.bracha.inclusion[src]
+	if ready := f.cfg.F*3 + 2; messageType == BrachaReady && len(included) > ready {
+		included = included[:ready]
+	}
+
+	return included
+}
+
+func (f *FakeQuorumAdversary) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	if _, ok := f.honest.(*BrachaImproved); ok {
+		f.observe(messageType, uid, data)
+	}
+
+	f.honest.Receive(messageType, src, uid, data)
+}
+
+func (f *FakeQuorumAdversary) Broadcast(uid uint32, payload Size, bc BroadcastInfo) {
+	f.honest.Broadcast(uid, payload, bc)
+}
+
+// fakeQuorumObserver passes all messages received by a protocol to observe first
+type fakeQuorumObserver struct {
+	Protocol
+	observe func(messageType uint8, uid uint32, data Size)
+}
+
+func (o *fakeQuorumObserver) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	o.observe(messageType, uid, data)
+	o.Protocol.Receive(messageType, src, uid, data)
+}
+
+// mapPaths replaces all paths contained in (possibly nested) Dolev messages with the result of f, f can safely modify
+// the path it is given as all paths are copied first. Messages that contain only a single path use the first result.
+func mapPaths(data Size, f func(algo.DolevPath) []algo.DolevPath) Size {
+	dolevPaths := func(paths []algo.DolevPath) []algo.DolevPath {
+		res := make([]algo.DolevPath, 0, len(paths))
+		for _, p := range paths {
+			cp := algo.DolevPath{
+				Desired: make(graphs.Path, len(p.Desired)),
+				Actual:  make(graphs.Path, len(p.Actual)),
+				Prio:    p.Prio,
+			}
+
+			copy(cp.Desired, p.Desired)
+			copy(cp.Actual, p.Actual)
+			res = append(res, f(cp)...)
+		}
+
+		return res
+	}
+
+	switch m := data.(type) {
+	case DolevMessage:
+		if res := dolevPaths([]algo.DolevPath{{Actual: m.Path}}); len(res) > 0 {
+			m.Path = res[0].Actual
+		}
+		return m
+	case DolevKnownMessage:
+		if res := dolevPaths([]algo.DolevPath{m.Path}); len(res) > 0 {
+			m.Path = res[0]
+		}
+		return m
+	case DolevUnicastMessage:
+		if res := dolevPaths([]algo.DolevPath{m.Path}); len(res) > 0 {
+			m.Path = res[0]
+		}
+		return m
+	case DolevKnownImprovedMessage:
+		m.Paths = dolevPaths(m.Paths)
+		m.Payload = mapPaths(m.Payload, f)
+		return m
+	case DolevWrapperMessage:
+		msgs := make([]dolevWrapperWrapper, 0, len(m.Msgs))
+		for _, w := range m.Msgs {
+			w.Paths = dolevPaths(w.Paths)
+			msgs = append(msgs, w)
+		}
+		m.Msgs = msgs
+		return m
+	case BrachaDolevWrapperMsg:
+		msgs := make([]BrachaDolevMessage, 0, len(m.Msgs))
+		for _, bm := range m.Msgs {
+			bm.Paths = dolevPaths(bm.Paths)
+			msgs = append(msgs, bm)
+		}
+		m.Msgs = msgs
+		return m
+	default:
+		return data
+	}
+}
@@ -0,0 +1,100 @@
+package brb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+	"testing"
+)
+
+type sentMessage struct {
+	messageType uint8
+	src, dest   uint64
+	data        Size
+}
+
+// captureNetwork keeps all messages sent by a process
+type captureNetwork struct {
+	sent []sentMessage
+}
+
+func (c *captureNetwork) Send(messageType uint8, dest uint64, _ uint32, data Size, _ BroadcastInfo) {
+	c.sent = append(c.sent, sentMessage{messageType: messageType, dest: dest, data: data})
+}
+
+func (c *captureNetwork) TriggerStat(uint32, NetworkStat) {}
+
+type captureApplication struct {
+	delivered []Size
+}
+
+func (c *captureApplication) Deliver(_ uint32, payload Size, _ uint64) {
+	c.delivered = append(c.delivered, payload)
+}
+
+func TestFakeQuorumMinimalSubset(t *testing.T) {
+	const n, f = 16, 2
+
+	g, err := graphs.FullyConnectedGenerator{}.Generate(n, n, 0)
+	require.NoError(t, err)
+
+	config := func(id uint64) Config {
+		cfg := Config{N: n, F: f, Id: id, Graph: g, Silent: true,
+			OptimizationConfig: OptimizationConfig{BrachaMinimalSubset: true}}
+		for i := uint64(0); i < n; i++ {
+			if i != id {
+				cfg.Neighbours = append(cfg.Neighbours, i)
+			}
+		}
+
+		return cfg
+	}
+
+	// The f Byzantine processes and the correct target all send readys for broadcasts of process 0
+	nodes, _ := graphs.Nodes(g)
+	included := algo.FindBrachaInclusionTable(g, nodes, n, f)[0]
+	require.Greater(t, len(included), f*3+2)
+	byzantine, target := included[:f], included[f]
+
+	var forged []sentMessage
+	for _, id := range byzantine {
+		bn := &captureNetwork{}
+		adv := &FakeQuorumAdversary{}
+		adv.Init(&BrachaImproved{}, bn, &captureApplication{}, config(id))
+		adv.Receive(BrachaSend, 0, 1, BrachaMessage{Src: 0, Payload: fuzzPayload("payload")})
+
+		for _, m := range bn.sent {
+			bm := m.data.(BrachaMessage)
+			if _, ok := bm.Payload.(EquivocatedPayload); !ok {
+				continue
+			}
+
+			// Echoes only count for the included processes, readys only for the first 3f+2 of them
+			switch m.messageType {
+			case BrachaEcho:
+				assert.Contains(t, included, m.dest)
+			case BrachaReady:
+				assert.Contains(t, included[:f*3+2], m.dest)
+			}
+
+			if m.dest == target {
+				m.src = id
+				forged = append(forged, m)
+			}
+		}
+	}
+	require.NotEmpty(t, forged)
+
+	p, app, net := &BrachaImproved{}, &captureApplication{}, &captureNetwork{}
+	p.Init(net, app, config(target))
+	for _, m := range forged {
+		p.Receive(m.messageType, m.src, 1, m.data)
+	}
+
+	// f forged readys are not enough to send a ready or to deliver
+	assert.Empty(t, app.delivered)
+	for _, m := range net.sent {
+		assert.NotEqual(t, BrachaReady, m.messageType)
+	}
+}
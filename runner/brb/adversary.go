@@ -0,0 +1,194 @@
+package brb
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Adversary defines the behaviour of a Byzantine process. Byzantine processes run an adversary instead of the
+// honest protocol, the adversary is free to use the honest protocol (e.g. to relay messages correctly) or to ignore it.
+type Adversary interface {
+	// Called instead of Protocol.Init, honest is an uninitialized instance of the protocol used by correct processes
+	Init(honest Protocol, n Network, app Application, cfg Config)
+
+	Receive(messageType uint8, src uint64, uid uint32, data Size)
+
+	Broadcast(uid uint32, payload Size, bc BroadcastInfo)
+}
+
+// DelayingAdversary is implemented by adversaries that hold messages, the maximum delay is set before Init
+type DelayingAdversary interface {
+	SetMaxDelay(d time.Duration)
+}
+
+// SpoofingNetwork is implemented by networks that can send messages as if they were sent by another process, correct
+// processes only reject these forged messages when links are authenticated
+type SpoofingNetwork interface {
+	SendAs(src uint64, messageType uint8, dest uint64, uid uint32, data Size)
+}
+
+// TimerNetwork is implemented by networks that can run a function later on for a message to dest, simulated networks
+// use their virtual clock so adversaries that hold messages do not break the determinism of the simulation
+type TimerNetwork interface {
+	After(dest uint64, d time.Duration, fn func())
+}
+
+// after runs fn after d for a message to dest using the timer of the network if it has one
+func after(n Network, dest uint64, d time.Duration, fn func()) {
+	if t, ok := n.(TimerNetwork); ok {
+		t.After(dest, d, fn)
+	} else {
+		time.AfterFunc(d, fn)
+	}
+}
+
+// Adversaries contains all available Byzantine strategies by name, these names are also used by the CLI
+var Adversaries = map[string]func() Adversary{
+	"silent":           func() Adversary { return &SilentAdversary{} },
+	"randomDrop":       func() Adversary { return &RandomDropAdversary{P: 0.5} },
+	"equivocate":       func() Adversary { return &EquivocateAdversary{Groups: 2} },
+	"fakeQuorum":       func() Adversary { return &FakeQuorumAdversary{} },
+	"forgePaths":       func() Adversary { return &ForgePathsAdversary{Mode: ForgeInventEdges, Payload: true} },
+	"forgeClaimPaths":  func() Adversary { return &ForgePathsAdversary{Mode: ForgeClaimNodes, Payload: true} },
+	"forgeDropHop":     func() Adversary { return &ForgePathsAdversary{Mode: ForgeDropHop, Payload: true} },
+	"replay":           func() Adversary { return &ReplayAdversary{Max: 100} },
+	"selectiveRelay":   func() Adversary { return &SelectiveRelayAdversary{Fraction: 0.5} },
+	"slowRelay":        func() Adversary { return &SlowRelayAdversary{Until: SlowUntilDelay} },
+	"slowRelayReady":   func() Adversary { return &SlowRelayAdversary{Until: SlowUntilReady} },
+	"slowRelayDeliver": func() Adversary { return &SlowRelayAdversary{Until: SlowUntilDeliver} },
+	"splitReady":       func() Adversary { return &CollusionAdversary{Strategy: &SplitReadyStrategy{}} },
+	"spoof":            func() Adversary { return &SpoofAdversary{} },
+	"alignPaths":       func() Adversary { return &CollusionAdversary{Strategy: &AlignPathsStrategy{}} },
+}
+
+// AdversaryNames returns the (sorted) names of all available Byzantine strategies
+func AdversaryNames() []string {
+	res := make([]string, 0, len(Adversaries))
+	for name := range Adversaries {
+		res = append(res, name)
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+// NewAdversary creates a new adversary by name, an empty name results in a silent adversary
+func NewAdversary(name string) (Adversary, error) {
+	if name == "" {
+		return &SilentAdversary{}, nil
+	}
+
+	f, ok := Adversaries[name]
+	if !ok {
+		return nil, errors.Errorf("unknown adversary: %v", name)
+	}
+
+	return f(), nil
+}
+
+// Byzantine is the protocol used by Byzantine processes, it hands all control to the adversary
+type Byzantine struct {
+	Honest Protocol
+	Adv    Adversary
+}
+
+var _ Protocol = (*Byzantine)(nil)
+
+func (b *Byzantine) Init(n Network, app Application, cfg Config) {
+	if !cfg.Silent {
+		fmt.Printf("process %v is a Byzantine node (%v running %v)\n", cfg.Id,
+			reflect.TypeOf(b.Adv).Elem().Name(), reflect.TypeOf(b.Honest).Elem().Name())
+	}
+
+	// The honest instance should behave honestly, Byzantine deliveries are of no interest
+	cfg.Byz = false
+	b.Adv.Init(b.Honest, n, byzantineApplication{}, cfg)
+}
+
+func (b *Byzantine) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	b.Adv.Receive(messageType, src, uid, data)
+}
+
+func (b *Byzantine) Broadcast(uid uint32, payload Size, bc BroadcastInfo) {
+	b.Adv.Broadcast(uid, payload, bc)
+}
+
+func (b *Byzantine) Category() ProtocolCategory {
+	return b.Honest.Category()
+}
+
+type byzantineApplication struct{}
+
+func (byzantineApplication) Deliver(uint32, Size, uint64) {}
+
+// adversaryNetwork allows adversaries to change or drop all messages sent by the honest protocol they control
+type adversaryNetwork struct {
+	Network
+	intercept func(messageType uint8, dest uint64, uid uint32, data Size) (Size, bool)
+}
+
+func (a adversaryNetwork) Send(messageType uint8, dest uint64, uid uint32, data Size, bc BroadcastInfo) {
+	if d, ok := a.intercept(messageType, dest, uid, data); ok {
+		a.Network.Send(messageType, dest, uid, d, bc)
+	}
+}
+
+// EquivocatedPayload is used by adversaries to replace a payload with a conflicting one
+type EquivocatedPayload struct {
+	Original Size
+	Variant  uint64
+}
+
+func (e EquivocatedPayload) SizeOf() uintptr {
+	if e.Original == nil {
+		return reflect.TypeOf(e.Variant).Size()
+	}
+
+	return e.Original.SizeOf()
+}
+
+// mapPayload applies f to the application payload contained in (possibly nested) protocol messages, digests of
+// payloads are left unchanged
+func mapPayload(data Size, f func(Size) Size) Size {
+	switch m := data.(type) {
+	case BrachaMessage:
+		m.Payload = mapPayload(m.Payload, f)
+		return m
+	case brachaWrapper:
+		m.msg = mapPayload(m.msg, f)
+		return m
+	case DolevMessage:
+		m.Payload = mapPayload(m.Payload, f)
+		return m
+	case DolevKnownMessage:
+		m.Payload = mapPayload(m.Payload, f)
+		return m
+	case DolevUnicastMessage:
+		m.Payload = mapPayload(m.Payload, f)
+		return m
+	case DolevKnownImprovedMessage:
+		m.Payload = mapPayload(m.Payload, f)
+		return m
+	case DolevWrapperMessage:
+		m.Payload = mapPayload(m.Payload, f)
+		return m
+	case BrachaDolevWrapperMsg:
+		m.OriginalPayload = mapPayload(m.OriginalPayload, f)
+		return m
+	case QuorumCertificate:
+		m.Payload = mapPayload(m.Payload, f)
+		return m
+	case SignedEchoMessage:
+		return m
+	case AvidMessage:
+		return m
+	case PayloadDigest:
+		// A digest does not contain the payload, so there is nothing to apply f to
+		return m
+	default:
+		return f(data)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"gonum.org/v1/gonum/graph/simple"
 	"reflect"
 	"rp-runner/graphs"
+	"sort"
 	"sync"
 )
 
@@ -46,6 +47,9 @@ func (t *FullRoutingTable) FindMatches(origin, partialId uint64, p graphs.Path,
 	}
 
 	var res []DolevPath
+	if len(p) == 0 {
+		return res
+	}
 
 	for dst, dolevs := range r {
 		if dst != uint64(p[0].To().ID()) {
@@ -239,9 +243,18 @@ func DolevRouting(r RoutingTable, combine, filter bool) BroadcastPlan {
 		FilterSubpaths(r)
 	}
 
+	// Destinations are sorted, so the paths to every next hop are always sent in the same order
+	dsts := make([]uint64, 0, len(r))
+	for dst := range r {
+		dsts = append(dsts, dst)
+	}
+	sort.Slice(dsts, func(i, j int) bool {
+		return dsts[i] < dsts[j]
+	})
+
 	br := make([]Path, 0, len(r))
-	for _, g := range r {
-		br = append(br, g...)
+	for _, dst := range dsts {
+		br = append(br, r[dst]...)
 	}
 
 	if combine {
@@ -0,0 +1,322 @@
+package brb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"rp-runner/brb/erasure"
+	"rp-runner/graphs"
+	"sort"
+)
+
+const (
+	AvidValue uint8 = 1
+	AvidEcho  uint8 = 2
+	AvidReady uint8 = 3
+)
+
+// AvidMessage contains a fragment of an erasure coded broadcast, with the proof that it belongs to the Merkle root of
+// all fragments. Ready messages only contain the root.
+type AvidMessage struct {
+	Src      uint64
+	Id       uint32
+	Root     []byte
+	Fragment []byte
+	Proof    [][]byte
+}
+
+func (a AvidMessage) SizeOf() uintptr {
+	r := reflect.TypeOf(a.Src).Size() + reflect.TypeOf(a.Id).Size() + uintptr(len(a.Root)+len(a.Fragment))
+	for _, p := range a.Proof {
+		r += uintptr(len(p))
+	}
+
+	return r
+}
+
+type avidIdentifier struct {
+	Src uint64
+	Id  uint32
+}
+
+type avidRoot struct {
+	avidIdentifier
+	Root [sha256.Size]byte
+}
+
+// avidBroadcast contains the fragments and ready messages received for a single root of a broadcast
+type avidBroadcast struct {
+	fragments [][]byte
+	echoes    int
+	ready     map[uint64]struct{}
+	invalid   bool
+}
+
+// Avid is erasure coded reliable broadcast (as used by HoneyBadgerBFT): the source splits the encoded payload in N
+// fragments of which any N-2f are enough to reconstruct it, and sends every process its own fragment with a Merkle
+// proof. Processes echo only their own fragment to all, so echo and ready messages do not carry the full payload.
+// It only works on fully connected networks.
+type Avid struct {
+	n   Network
+	app Application
+	cfg Config
+
+	cnt   uint32
+	bcId  int
+	k     int
+	ids   []uint64
+	index map[uint64]int
+
+	echoed     map[avidIdentifier]struct{}
+	readySent  map[avidIdentifier]struct{}
+	delivered  map[avidIdentifier]struct{}
+	tracking   map[avidIdentifier]uint32
+	broadcasts map[avidRoot]*avidBroadcast
+}
+
+var _ Protocol = (*Avid)(nil)
+
+func (a *Avid) Init(n Network, app Application, cfg Config) {
+	a.n = n
+	a.app = app
+	a.cfg = cfg
+	a.k = cfg.N - 2*cfg.F
+	a.echoed = make(map[avidIdentifier]struct{})
+	a.readySent = make(map[avidIdentifier]struct{})
+	a.delivered = make(map[avidIdentifier]struct{})
+	a.tracking = make(map[avidIdentifier]uint32)
+	a.broadcasts = make(map[avidRoot]*avidBroadcast)
+
+	if !cfg.Unused {
+		if cfg.Graph == nil {
+			panic("avid needs graph!")
+		}
+
+		if !graphs.IsFullyConnected(cfg.Graph) {
+			panic("avid does not work on non-fully connected networks!")
+		}
+	}
+
+	if a.k < 1 {
+		panic("avid needs more than 2f processes!")
+	}
+
+	// Every process has the fragment at its position in the sorted ids
+	a.ids = append([]uint64{cfg.Id}, cfg.Neighbours...)
+	sort.Slice(a.ids, func(i, j int) bool {
+		return a.ids[i] < a.ids[j]
+	})
+
+	a.index = make(map[uint64]int, len(a.ids))
+	for i, id := range a.ids {
+		a.index[id] = i
+	}
+}
+
+func (a *Avid) send(messageType uint8, uid uint32, data Size, to []uint64) {
+	i := a.bcId
+	a.bcId += 1
+
+	for _, n := range to {
+		if n != a.cfg.Id {
+			a.n.Send(messageType, n, uid, data, BroadcastInfo{
+				Type: BrachaEveryone,
+				Id:   i,
+			})
+		}
+	}
+}
+
+// broadcast returns the state of a root of a broadcast, it returns nil if the root is malformed
+func (a *Avid) broadcast(m AvidMessage) (avidRoot, *avidBroadcast) {
+	key := avidRoot{avidIdentifier: avidIdentifier{Src: m.Src, Id: m.Id}}
+	if len(m.Root) != len(key.Root) {
+		return key, nil
+	}
+	copy(key.Root[:], m.Root)
+
+	b, ok := a.broadcasts[key]
+	if !ok {
+		b = &avidBroadcast{fragments: make([][]byte, len(a.ids)), ready: make(map[uint64]struct{})}
+		a.broadcasts[key] = b
+	}
+
+	return key, b
+}
+
+// valid returns whether the fragment of a message belongs to the process at index i
+func (a *Avid) valid(m AvidMessage, i int) bool {
+	return len(m.Root) == sha256.Size && erasure.VerifyMerkle(m.Root, i, len(a.ids), m.Fragment, m.Proof)
+}
+
+// echo sends the own fragment of a broadcast to all, this is done only once for every broadcast
+func (a *Avid) echo(uid uint32, m AvidMessage) {
+	a.echoed[avidIdentifier{Src: m.Src, Id: m.Id}] = struct{}{}
+	a.send(AvidEcho, uid, m, a.cfg.Neighbours)
+	a.receiveEcho(uid, a.cfg.Id, m)
+}
+
+func (a *Avid) receiveEcho(uid uint32, src uint64, m AvidMessage) {
+	key, b := a.broadcast(m)
+	i := a.index[src]
+
+	if b.fragments[i] != nil {
+		return
+	}
+	b.fragments[i] = m.Fragment
+	b.echoes += 1
+
+	if b.echoes >= a.cfg.N-a.cfg.F {
+		a.ready(uid, key, b)
+	}
+	a.deliver(key, b)
+}
+
+// ready sends a ready message for a root, a process is ready for only one root of every broadcast
+func (a *Avid) ready(uid uint32, key avidRoot, b *avidBroadcast) {
+	if _, ok := a.readySent[key.avidIdentifier]; ok {
+		return
+	}
+	a.readySent[key.avidIdentifier] = struct{}{}
+
+	a.send(AvidReady, uid, AvidMessage{Src: key.Src, Id: key.Id, Root: key.Root[:]}, a.cfg.Neighbours)
+	b.ready[a.cfg.Id] = struct{}{}
+}
+
+// deliver reconstructs and delivers the payload once 2f+1 processes are ready and enough fragments are received, using
+// the uid of the first message received for the broadcast
+func (a *Avid) deliver(key avidRoot, b *avidBroadcast) {
+	if _, ok := a.delivered[key.avidIdentifier]; ok || b.invalid {
+		return
+	}
+
+	if len(b.ready) < 2*a.cfg.F+1 || b.echoes < a.k {
+		return
+	}
+
+	payload, ok := a.reconstruct(key, b)
+	if !ok {
+		// The source did not encode its payload correctly, so no correct process will deliver it
+		b.invalid = true
+		return
+	}
+
+	a.delivered[key.avidIdentifier] = struct{}{}
+	a.app.Deliver(a.tracking[key.avidIdentifier], payload, key.Src)
+	delete(a.tracking, key.avidIdentifier)
+
+	for k := range a.broadcasts {
+		if k.avidIdentifier == key.avidIdentifier {
+			delete(a.broadcasts, k)
+		}
+	}
+}
+
+// reconstruct decodes the payload from the fragments, and checks that encoding it again results in the same root
+func (a *Avid) reconstruct(key avidRoot, b *avidBroadcast) (Size, bool) {
+	data, err := erasure.Decode(b.fragments, a.k)
+	if err != nil {
+		return nil, false
+	}
+
+	fragments, err := erasure.Encode(data, a.k, len(a.ids))
+	if err != nil {
+		return nil, false
+	}
+
+	if root, _ := erasure.MerkleTree(fragments); !bytes.Equal(root, key.Root[:]) {
+		return nil, false
+	}
+
+	payload, err := Decode(data)
+	if err != nil || !validPayload(payload) {
+		return nil, false
+	}
+
+	return payload, true
+}
+
+func (a *Avid) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	m, ok := data.(AvidMessage)
+	if !ok {
+		a.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
+	id := avidIdentifier{Src: m.Src, Id: m.Id}
+	if _, ok := a.delivered[id]; ok {
+		return
+	}
+
+	if _, ok := a.tracking[id]; !ok {
+		a.tracking[id] = uid
+	}
+
+	switch messageType {
+	case AvidValue:
+		// Only the source itself sends fragments to every process
+		if m.Src != src || !a.valid(m, a.index[a.cfg.Id]) {
+			a.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		if _, ok := a.echoed[id]; !ok {
+			a.echo(uid, m)
+		}
+	case AvidEcho:
+		// Every process echoes only its own fragment
+		i, ok := a.index[src]
+		if !ok || !a.valid(m, i) {
+			a.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		a.receiveEcho(uid, src, m)
+	case AvidReady:
+		key, b := a.broadcast(m)
+		if b == nil {
+			a.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		b.ready[src] = struct{}{}
+		if len(b.ready) >= a.cfg.F+1 {
+			a.ready(uid, key, b)
+		}
+		a.deliver(key, b)
+	default:
+		a.n.TriggerStat(uid, MalformedMessage)
+	}
+}
+
+func (a *Avid) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
+	id := a.cnt
+	a.cnt += 1
+	a.tracking[avidIdentifier{Src: a.cfg.Id, Id: id}] = uid
+
+	data, err := Encode(payload)
+	if err != nil {
+		panic(fmt.Sprintf("avid can not encode payload: %v", err))
+	}
+
+	fragments, err := erasure.Encode(data, a.k, len(a.ids))
+	if err != nil {
+		panic(fmt.Sprintf("avid can not split payload: %v", err))
+	}
+	root, proofs := erasure.MerkleTree(fragments)
+
+	for i, n := range a.ids {
+		m := AvidMessage{Src: a.cfg.Id, Id: id, Root: root, Fragment: fragments[i], Proof: proofs[i]}
+
+		if n == a.cfg.Id {
+			a.echo(uid, m)
+		} else {
+			a.send(AvidValue, uid, m, []uint64{n})
+		}
+	}
+}
+
+func (a *Avid) Category() ProtocolCategory {
+	return BrachaCat
+}
@@ -2,7 +2,6 @@ package brb
 
 import (
 	"crypto/sha256"
-	"fmt"
 	"math"
 	"reflect"
 	"rp-runner/graphs"
@@ -12,6 +11,10 @@ const (
 	BrachaSend  uint8 = 1
 	BrachaEcho  uint8 = 2
 	BrachaReady uint8 = 3
+
+	// Only used by BrachaImproved when echo and ready messages contain digests
+	BrachaRequest uint8 = 4
+	BrachaReply   uint8 = 5
 )
 
 type BrachaMessage struct {
@@ -24,10 +27,12 @@ func (b BrachaMessage) SizeOf() uintptr {
 	return reflect.TypeOf(b.Src).Size() + reflect.TypeOf(b.Id).Size() + b.Payload.SizeOf()
 }
 
+// brachaIdentifier identifies a broadcast by its source, sequence number and payload hash, so messages with the same
+// contents are counted together regardless of their tracking uid
 type brachaIdentifier struct {
-	Src            uint64
-	Id, TrackingId uint32
-	Hash           [sha256.Size]byte
+	Src  uint64
+	Id   uint32
+	Hash [sha256.Size]byte
 }
 
 // Original Bracha Protocol
@@ -41,6 +46,9 @@ type Bracha struct {
 
 	delivered map[brachaIdentifier]struct{}
 
+	// Uid of the first message received for every broadcast that is not delivered yet, later messages may be replayed
+	tracking map[brachaIdentifier]uint32
+
 	echo  map[brachaIdentifier]map[uint64]struct{}
 	ready map[brachaIdentifier]map[uint64]struct{}
 
@@ -59,14 +67,11 @@ func (b *Bracha) Init(n Network, app Application, cfg Config) {
 	b.app = app
 	b.cfg = cfg
 	b.delivered = make(map[brachaIdentifier]struct{})
+	b.tracking = make(map[brachaIdentifier]uint32)
 	b.echo = make(map[brachaIdentifier]map[uint64]struct{})
 	b.ready = make(map[brachaIdentifier]map[uint64]struct{})
 	b.echoSent = make(map[brachaIdentifier]struct{})
 	b.readySent = make(map[brachaIdentifier]struct{})
-
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Bracha Byzantine node\n", cfg.Id)
-	}
 }
 
 func (b *Bracha) send(messageType uint8, uid uint32, id brachaIdentifier, data BrachaMessage) {
@@ -96,18 +101,22 @@ func (b *Bracha) hasDelivered(id brachaIdentifier) bool {
 }
 
 func (b *Bracha) Receive(messageType uint8, src uint64, uid uint32, data Size) {
-	if b.cfg.Byz {
-		// TODO: better byzantine behaviour?
+	// Requests and replies are only used by BrachaImproved
+	m, ok := decodeBracha(messageType, data)
+	if !ok || messageType > BrachaReady {
+		b.n.TriggerStat(uid, MalformedMessage)
 		return
 	}
 
-	m := data.(BrachaMessage)
+	// Only the source itself can send the initial message, links are authenticated so src can be trusted
+	if messageType == BrachaSend && m.Src != src {
+		return
+	}
 
 	id := brachaIdentifier{
-		Src:        m.Src,
-		Id:         m.Id,
-		TrackingId: uid,
-		Hash:       MustHash(m.Payload),
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
 	}
 
 	_, echoMade := b.echo[id]
@@ -118,6 +127,10 @@ func (b *Bracha) Receive(messageType uint8, src uint64, uid uint32, data Size) {
 	}
 
 	del := b.hasDelivered(id)
+	if _, ok := b.tracking[id]; !ok && !del {
+		b.tracking[id] = uid
+	}
+
 	switch messageType {
 	case BrachaSend:
 		b.send(BrachaEcho, uid, id, m)
@@ -147,9 +160,10 @@ func (b *Bracha) Receive(messageType uint8, src uint64, uid uint32, data Size) {
 	// Deliver if enough readys
 	if !b.hasDelivered(id) && len(b.ready[id]) >= b.cfg.F*2+1 {
 		b.delivered[id] = struct{}{}
-		b.app.Deliver(uid, m.Payload, m.Src)
+		b.app.Deliver(b.tracking[id], m.Payload, m.Src)
 
 		// Memory cleanup
+		delete(b.tracking, id)
 		delete(b.echo, id)
 		delete(b.ready, id)
 		delete(b.echoSent, id)
@@ -159,10 +173,9 @@ func (b *Bracha) Receive(messageType uint8, src uint64, uid uint32, data Size) {
 
 func (b *Bracha) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
 	id := brachaIdentifier{
-		Src:        b.cfg.Id,
-		Id:         b.cnt,
-		TrackingId: uid,
-		Hash:       MustHash(payload),
+		Src:  b.cfg.Id,
+		Id:   b.cnt,
+		Hash: MustHash(payload),
 	}
 
 	if _, ok := b.delivered[id]; !ok {
@@ -170,6 +183,7 @@ func (b *Bracha) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
 			b.cfg.Id: {},
 		}
 		b.ready[id] = make(map[uint64]struct{})
+		b.tracking[id] = uid
 
 		m := BrachaMessage{
 			Src:     b.cfg.Id,
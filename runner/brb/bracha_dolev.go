@@ -1,7 +1,6 @@
 package brb
 
 import (
-	"fmt"
 	"reflect"
 )
 
@@ -36,10 +35,6 @@ func (bd *BrachaDolev) Init(n Network, app Application, cfg Config) {
 	bd.brachaBroadcast = make(map[int]struct{})
 
 	sil := cfg.Silent
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Bracha-Dolev Byzantine node\n", cfg.Id)
-	}
-
 	cfg.Silent = true
 
 	// Create bracha instance with BD as the network
@@ -89,7 +84,12 @@ func (bd *BrachaDolev) Deliver(uid uint32, payload Size, src uint64) {
 	}
 
 	// Dolev is delivering a message, so send it to Bracha
-	m := payload.(brachaWrapper)
+	m, ok := decodeBrachaWrapper(payload)
+	if !ok {
+		bd.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
 	bd.b.Receive(m.messageType, src, uid, m.msg)
 	//fmt.Printf("proc %v has Dolev delivered %v (%v from %v) through dolev with type %v\n", bd.cfg.Id, m.msg, reflect.TypeOf(m.msg).Name(), src, m.messageType)
 }
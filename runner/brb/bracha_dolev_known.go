@@ -1,7 +1,6 @@
 package brb
 
 import (
-	"fmt"
 	"reflect"
 	"rp-runner/brb/algo"
 	"rp-runner/graphs"
@@ -109,6 +108,9 @@ type brachaDolevKnownWrapper struct {
 	bracha Protocol
 	dolev  Protocol
 
+	// Messages meant for specific processes (payload requests and replies) are not broadcast
+	unicast dolevUnicast
+
 	n   Network
 	app Application
 	cfg Config
@@ -123,10 +125,6 @@ func (bd *brachaDolevKnownWrapper) Init(n Network, app Application, cfg Config)
 	bd.brachaBroadcast = make(map[int]struct{})
 
 	sil := cfg.Silent
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Bracha-Dolev Byzantine node\n", cfg.Id)
-	}
-
 	cfg.Silent = true
 
 	bCfg := cfg
@@ -154,11 +152,20 @@ func (bd *brachaDolevKnownWrapper) Init(n Network, app Application, cfg Config)
 	}
 	cfg.AdditionalConfig = BrachaDolevConfig{}
 	bd.dolev.Init(n, bd, cfg)
+	bd.unicast.Init(n, cfg)
 
 	cfg.Silent = sil
 }
 
 func (bd *brachaDolevKnownWrapper) Send(messageType uint8, dest uint64, uid uint32, data Size, bc BroadcastInfo) {
+	if bc.Type == BrachaDirect {
+		bd.unicast.Send(uid, dest, brachaWrapper{
+			messageType: messageType,
+			msg:         data,
+		})
+		return
+	}
+
 	if _, ok := bd.brachaBroadcast[bc.Id]; !ok {
 		// A message is broadcast only once to all
 		bd.brachaBroadcast[bc.Id] = struct{}{}
@@ -186,7 +193,11 @@ func (bd *brachaDolevKnownWrapper) Send(messageType uint8, dest uint64, uid uint
 
 func (bd *brachaDolevKnownWrapper) Deliver(uid uint32, payload Size, src uint64) {
 	// Dolev is delivering a message, so send it to Bracha
-	m := payload.(brachaWrapper)
+	m, ok := decodeBrachaWrapper(payload)
+	if !ok {
+		bd.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
 
 	if src == bd.cfg.Id {
 		return
@@ -204,6 +215,13 @@ func (bd *brachaDolevKnownWrapper) Deliver(uid uint32, payload Size, src uint64)
 }
 
 func (bd *brachaDolevKnownWrapper) Receive(_ uint8, src uint64, uid uint32, data Size) {
+	if _, ok := data.(DolevUnicastMessage); ok {
+		if m, ok := bd.unicast.Receive(src, uid, data); ok {
+			bd.Deliver(uid, m.Payload, m.Src)
+		}
+		return
+	}
+
 	// Network is delivering a messages, pass to Dolev
 	bd.dolev.Receive(0, src, uid, data)
 }
@@ -1,12 +1,30 @@
 package brb
 
 import (
-	"fmt"
+	"crypto/sha256"
 	"math"
+	"reflect"
 	"rp-runner/brb/algo"
 	"rp-runner/graphs"
+	"sort"
 )
 
+// PayloadDigest replaces the payload of echo and ready messages when BrachaDigest is enabled. Requests for the payload
+// contain the processes asked to reply, if none are given all processes that have the payload reply.
+type PayloadDigest struct {
+	Hash    [sha256.Size]byte
+	Holders []uint64
+}
+
+func (d PayloadDigest) SizeOf() uintptr {
+	return uintptr(len(d.Hash)) + uintptr(len(d.Holders))*reflect.TypeOf(uint64(0)).Size()
+}
+
+type brachaReply struct {
+	id brachaIdentifier
+	to uint64
+}
+
 // Improved version for RP Tim Anema
 type BrachaImproved struct {
 	n   Network
@@ -17,6 +35,7 @@ type BrachaImproved struct {
 	bcId int
 
 	delivered map[brachaIdentifier]struct{}
+	tracking  map[brachaIdentifier]uint32
 
 	echo  map[brachaIdentifier]map[uint64]struct{}
 	ready map[brachaIdentifier]map[uint64]struct{}
@@ -28,6 +47,11 @@ type BrachaImproved struct {
 	participatingEcho  map[brachaIdentifier]bool
 	participatingReady map[brachaIdentifier]bool
 
+	// Modification Bracha 3: Echo and ready messages only contain a digest, the payload is requested when needed
+	payloads  map[brachaIdentifier]Size
+	requested map[brachaIdentifier]struct{}
+	replied   map[brachaReply]struct{}
+
 	inclusion algo.BrachaInclusionTable
 }
 
@@ -38,12 +62,16 @@ func (b *BrachaImproved) Init(n Network, app Application, cfg Config) {
 	b.app = app
 	b.cfg = cfg
 	b.delivered = make(map[brachaIdentifier]struct{})
+	b.tracking = make(map[brachaIdentifier]uint32)
 	b.echo = make(map[brachaIdentifier]map[uint64]struct{})
 	b.ready = make(map[brachaIdentifier]map[uint64]struct{})
 	b.echoSent = make(map[brachaIdentifier]struct{})
 	b.readySent = make(map[brachaIdentifier]struct{})
 	b.participatingEcho = make(map[brachaIdentifier]bool)
 	b.participatingReady = make(map[brachaIdentifier]bool)
+	b.payloads = make(map[brachaIdentifier]Size)
+	b.requested = make(map[brachaIdentifier]struct{})
+	b.replied = make(map[brachaReply]struct{})
 
 	c, bd := cfg.AdditionalConfig.(BrachaDolevConfig)
 
@@ -71,10 +99,6 @@ func (b *BrachaImproved) Init(n Network, app Application, cfg Config) {
 			b.inclusion[n] = cfg.Neighbours
 		}
 	}
-
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Bracha Byzantine node\n", cfg.Id)
-	}
 }
 
 func (b *BrachaImproved) send(messageType uint8, uid uint32, id brachaIdentifier, data Size, to []uint64) {
@@ -88,9 +112,15 @@ func (b *BrachaImproved) send(messageType uint8, uid uint32, id brachaIdentifier
 		return
 	}
 
+	if b.cfg.OptimizationConfig.BrachaDigest && (messageType == BrachaEcho || messageType == BrachaReady) {
+		data = BrachaMessage{Src: id.Src, Id: id.Id, Payload: PayloadDigest{Hash: id.Hash}}
+	}
+
 	t := BrachaEveryone
 	if b.cfg.OptimizationConfig.BrachaMinimalSubset && (messageType == BrachaSend || messageType == BrachaEcho) {
 		t = BrachaPartial
+	} else if addressed(messageType, data) {
+		t = BrachaDirect
 	}
 
 	i := b.bcId
@@ -111,18 +141,58 @@ func (b *BrachaImproved) hasDelivered(id brachaIdentifier) bool {
 }
 
 func (b *BrachaImproved) Receive(messageType uint8, src uint64, uid uint32, data Size) {
-	if b.cfg.Byz {
-		// TODO: better byzantine behaviour?
+	m, ok := decodeBracha(messageType, data)
+	if !ok {
+		b.n.TriggerStat(uid, MalformedMessage)
 		return
 	}
 
-	m := data.(BrachaMessage)
+	// Digests can only replace the payload of echo and ready messages, and are required in requests
+	digest, isDigest := m.Payload.(PayloadDigest)
+	switch {
+	case !b.cfg.OptimizationConfig.BrachaDigest:
+		ok = !isDigest && messageType <= BrachaReady
+	case messageType == BrachaSend || messageType == BrachaReply:
+		ok = !isDigest
+	case messageType == BrachaRequest:
+		ok = isDigest
+	}
+
+	if !ok {
+		b.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
+	// Only the source itself can send the initial message, links are authenticated so src can be trusted
+	if messageType == BrachaSend && m.Src != src {
+		return
+	}
 
 	id := brachaIdentifier{
-		Src:        m.Src,
-		Id:         m.Id,
-		TrackingId: uid,
-		Hash:       MustHash(m.Payload),
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
+	}
+
+	if isDigest {
+		id.Hash = digest.Hash
+	}
+
+	if _, ok := b.tracking[id]; !ok && !b.hasDelivered(id) {
+		b.tracking[id] = uid
+	}
+
+	switch messageType {
+	case BrachaRequest:
+		b.reply(uid, src, id, digest)
+		return
+	case BrachaReply:
+		// Replies are only accepted when requested, their payload matches the digest as it is part of the identifier
+		if _, ok := b.requested[id]; ok && !b.hasDelivered(id) {
+			b.payloads[id] = m.Payload
+			b.deliver(id, m.Payload)
+		}
+		return
 	}
 
 	_, echoMade := b.echo[id]
@@ -158,6 +228,10 @@ func (b *BrachaImproved) Receive(messageType uint8, src uint64, uid uint32, data
 	del := b.hasDelivered(id)
 	switch messageType {
 	case BrachaSend:
+		if b.cfg.OptimizationConfig.BrachaDigest {
+			b.payloads[id] = m.Payload
+		}
+
 		// Modification Bracha 1: Use implicit echo messages
 		b.send(BrachaEcho, uid, id, data, b.inclusion[m.Src])
 
@@ -189,23 +263,102 @@ func (b *BrachaImproved) Receive(messageType uint8, src uint64, uid uint32, data
 
 	// Deliver if enough readys
 	if !b.hasDelivered(id) && len(b.ready[id]) >= b.cfg.F*2+1 {
-		b.delivered[id] = struct{}{}
-		b.app.Deliver(uid, m.Payload, m.Src)
+		payload := m.Payload
+		if b.cfg.OptimizationConfig.BrachaDigest {
+			if payload, ok = b.payloads[id]; !ok {
+				b.request(uid, id)
+				return
+			}
+		}
+
+		b.deliver(id, payload)
+	}
+}
+
+// deliver delivers a payload with the uid of the first message received for the broadcast, which can not be taken
+// over by replayed messages
+func (b *BrachaImproved) deliver(id brachaIdentifier, payload Size) {
+	b.delivered[id] = struct{}{}
+	b.app.Deliver(b.tracking[id], payload, id.Src)
+
+	// Memory cleanup, payloads are kept to reply to requests
+	delete(b.tracking, id)
+	delete(b.echo, id)
+	delete(b.ready, id)
+	delete(b.echoSent, id)
+	delete(b.readySent, id)
+	delete(b.requested, id)
+}
+
+// request asks f+1 processes that echoed for the payload, of which at least one is correct and has it. When less
+// echoes are known (e.g. when not participating in the echo phase), all processes are asked.
+func (b *BrachaImproved) request(uid uint32, id brachaIdentifier) {
+	if _, ok := b.requested[id]; ok {
+		return
+	}
+	b.requested[id] = struct{}{}
+
+	holders := make([]uint64, 0, len(b.echo[id]))
+	for n := range b.echo[id] {
+		if n != b.cfg.Id {
+			holders = append(holders, n)
+		}
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		return holders[i] < holders[j]
+	})
+
+	to := b.cfg.Neighbours
+	if len(holders) > b.cfg.F {
+		holders = holders[:b.cfg.F+1]
+		to = holders
+	} else {
+		holders = nil
+	}
 
-		// Memory cleanup
-		delete(b.echo, id)
-		delete(b.ready, id)
-		delete(b.echoSent, id)
-		delete(b.readySent, id)
+	b.n.TriggerStat(uid, PayloadRequest)
+	b.send(BrachaRequest, uid, id, BrachaMessage{Src: id.Src, Id: id.Id, Payload: PayloadDigest{Hash: id.Hash,
+		Holders: holders}}, to)
+}
+
+// addressed returns whether a message is meant for specific processes only, which are replies and requests to the
+// processes that echoed the payload
+func addressed(messageType uint8, data Size) bool {
+	if messageType == BrachaReply {
+		return true
 	}
+
+	m, _ := data.(BrachaMessage)
+	d, ok := m.Payload.(PayloadDigest)
+	return messageType == BrachaRequest && ok && len(d.Holders) > 0
+}
+
+// reply sends the payload to a process that requested it, only once for every request
+func (b *BrachaImproved) reply(uid uint32, src uint64, id brachaIdentifier, d PayloadDigest) {
+	payload, ok := b.payloads[id]
+	if !ok {
+		return
+	}
+
+	asked := len(d.Holders) == 0
+	for _, n := range d.Holders {
+		asked = asked || n == b.cfg.Id
+	}
+
+	r := brachaReply{id: id, to: src}
+	if _, ok := b.replied[r]; ok || !asked {
+		return
+	}
+	b.replied[r] = struct{}{}
+
+	b.send(BrachaReply, uid, id, BrachaMessage{Src: id.Src, Id: id.Id, Payload: payload}, []uint64{src})
 }
 
 func (b *BrachaImproved) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
 	id := brachaIdentifier{
-		Src:        b.cfg.Id,
-		Id:         b.cnt,
-		TrackingId: uid,
-		Hash:       MustHash(payload),
+		Src:  b.cfg.Id,
+		Id:   b.cnt,
+		Hash: MustHash(payload),
 	}
 
 	if _, ok := b.delivered[id]; !ok {
@@ -216,6 +369,11 @@ func (b *BrachaImproved) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
 
 		b.participatingEcho[id] = true
 		b.participatingReady[id] = true
+		b.tracking[id] = uid
+
+		if b.cfg.OptimizationConfig.BrachaDigest {
+			b.payloads[id] = payload
+		}
 
 		m := BrachaMessage{
 			Src:     b.cfg.Id,
@@ -1,7 +1,10 @@
 package brb
 
 import (
+	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/graph/simple"
+	"math/rand"
+	"reflect"
 	"rp-runner/brb/algo"
 )
 
@@ -23,6 +26,8 @@ type BroadcastInfo struct {
 const (
 	BrachaEveryone int = iota
 	BrachaPartial
+	// BrachaDirect messages are meant for their destination only, instead of being sent to every process
+	BrachaDirect
 )
 
 type Network interface {
@@ -39,14 +44,16 @@ const (
 	BrachaDolevMerge
 	DolevPayloadMerge
 	DolevPathMerge
+	MalformedMessage
+	PayloadRequest
 )
 
 type OptimizationConfig struct {
 	DolevFilterSubpaths, DolevSingleHopNeighbour,
 	DolevCombineNextHops, DolevReusePaths,
 	DolevRelayMerging, DolevPayloadMerging, DolevImplicitPath bool
-	BrachaImplicitEcho, BrachaMinimalSubset       bool
-	BrachaDolevPartialBroadcast, BrachaDolevMerge bool
+	BrachaImplicitEcho, BrachaMinimalSubset, BrachaDigest bool
+	BrachaDolevPartialBroadcast, BrachaDolevMerge         bool
 }
 
 type PrecomputedValues struct {
@@ -65,6 +72,21 @@ type Config struct {
 	AdditionalConfig   interface{}
 	OptimizationConfig OptimizationConfig
 	Precomputed        PrecomputedValues
+
+	// Keys of protocols that sign their messages
+	Signing SignatureKeys
+
+	// Source of all random choices of adversaries, seeded so their behaviour can be reproduced
+	Rand *rand.Rand
+}
+
+// random returns the source of randomness of the process, a randomly seeded one if none is set
+func (c Config) random() *rand.Rand {
+	if c.Rand == nil {
+		return rand.New(rand.NewSource(rand.Int63()))
+	}
+
+	return c.Rand
 }
 
 type ProtocolCategory int
@@ -87,3 +109,36 @@ type Protocol interface {
 
 	Category() ProtocolCategory
 }
+
+// Protocols contains all BRB protocols by the name of their type, used to create protocols in other OS processes
+var Protocols = map[string]func() Protocol{
+	"Flooding":                 func() Protocol { return &Flooding{} },
+	"Bracha":                   func() Protocol { return &Bracha{} },
+	"BrachaImproved":           func() Protocol { return &BrachaImproved{} },
+	"BrachaDolev":              func() Protocol { return &BrachaDolev{} },
+	"BrachaDolevKnown":         func() Protocol { return &BrachaDolevKnown{} },
+	"BrachaDolevKnownImproved": func() Protocol { return &BrachaDolevKnownImproved{} },
+	"Dolev":                    func() Protocol { return &Dolev{} },
+	"DolevImproved":            func() Protocol { return &DolevImproved{} },
+	"DolevKnown":               func() Protocol { return &DolevKnown{} },
+	"DolevKnownImproved":       func() Protocol { return &DolevKnownImproved{} },
+	"DolevUnknown":             func() Protocol { return &DolevUnknown{} },
+	"SignedEcho":               func() Protocol { return &SignedEcho{} },
+	"SignedEchoDolev":          func() Protocol { return &SignedEchoDolev{} },
+	"Avid":                     func() Protocol { return &Avid{} },
+}
+
+// ProtocolName returns the name of protocol p in Protocols
+func ProtocolName(p Protocol) string {
+	return reflect.TypeOf(p).Elem().Name()
+}
+
+// NewProtocol creates a new protocol by name
+func NewProtocol(name string) (Protocol, error) {
+	f, ok := Protocols[name]
+	if !ok {
+		return nil, errors.Errorf("unknown protocol: %v", name)
+	}
+
+	return f(), nil
+}
@@ -0,0 +1,311 @@
+package brb
+
+import (
+	"gonum.org/v1/gonum/graph/simple"
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+	"sort"
+	"sync"
+)
+
+// CollusionStrategy is the scripting hook for attacks that require all Byzantine processes to work together. All
+// calls are serialized by the Coordinator, so strategies do not need any locking.
+type CollusionStrategy interface {
+	// Called once, before any message is sent
+	Init(c *Coordinator)
+
+	// Called for every message sent by the honest protocol of Byzantine process id, the message is dropped if false
+	// is returned
+	Send(c *Coordinator, id uint64, messageType uint8, dest uint64, uid uint32, data Size) (Size, bool)
+
+	// Called for every message received by Byzantine process id, before its honest protocol handles it
+	Receive(c *Coordinator, id uint64, messageType uint8, src uint64, uid uint32, data Size)
+}
+
+// Colluding adversaries share a Coordinator with all other Byzantine processes
+type Colluding interface {
+	Join(c *Coordinator)
+}
+
+// Coordinator is shared by all Byzantine processes of a run, it hands control over all of them to a single strategy
+type Coordinator struct {
+	Graph              *simple.WeightedUndirectedGraph
+	N, F               int
+	Byzantine, Correct []uint64
+
+	strategy CollusionStrategy
+	members  map[uint64]Config
+	networks map[uint64]Network
+	lock     sync.Mutex
+}
+
+func NewCoordinator(g *simple.WeightedUndirectedGraph, F int, byzantine []uint64) *Coordinator {
+	nodes, _ := graphs.Nodes(g)
+	isByz := make(map[uint64]struct{}, len(byzantine))
+	for _, b := range byzantine {
+		isByz[b] = struct{}{}
+	}
+
+	c := &Coordinator{
+		Graph:     g,
+		N:         len(nodes),
+		F:         F,
+		Byzantine: append([]uint64(nil), byzantine...),
+		members:   make(map[uint64]Config),
+		networks:  make(map[uint64]Network),
+	}
+
+	for _, n := range nodes {
+		if _, ok := isByz[n]; !ok {
+			c.Correct = append(c.Correct, n)
+		}
+	}
+
+	sort.Slice(c.Byzantine, func(i, j int) bool { return c.Byzantine[i] < c.Byzantine[j] })
+	sort.Slice(c.Correct, func(i, j int) bool { return c.Correct[i] < c.Correct[j] })
+
+	return c
+}
+
+// IsByzantine returns whether process id is controlled by the coordinator
+func (c *Coordinator) IsByzantine(id uint64) bool {
+	i := sort.Search(len(c.Byzantine), func(i int) bool { return c.Byzantine[i] >= id })
+	return i < len(c.Byzantine) && c.Byzantine[i] == id
+}
+
+// Corrupt moves a correct process to the Byzantine processes, used for adaptive corruption
+func (c *Coordinator) Corrupt(id uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.IsByzantine(id) {
+		return
+	}
+
+	correct := make([]uint64, 0, len(c.Correct))
+	for _, n := range c.Correct {
+		if n != id {
+			correct = append(correct, n)
+		}
+	}
+
+	c.Correct = correct
+	c.Byzantine = append(c.Byzantine, id)
+	sort.Slice(c.Byzantine, func(i, j int) bool { return c.Byzantine[i] < c.Byzantine[j] })
+}
+
+// Config returns the configuration of Byzantine process id, only valid for processes that have joined
+func (c *Coordinator) Config(id uint64) Config {
+	return c.members[id]
+}
+
+// SendAs sends a message from Byzantine process id, bypassing the strategy. Can only be used by the strategy.
+func (c *Coordinator) SendAs(id uint64, messageType uint8, dest uint64, uid uint32, data Size) {
+	if n, ok := c.networks[id]; ok {
+		n.Send(messageType, dest, uid, data, BroadcastInfo{})
+	}
+}
+
+func (c *Coordinator) use(s CollusionStrategy) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.strategy == nil {
+		c.strategy = s
+		s.Init(c)
+	}
+}
+
+func (c *Coordinator) join(cfg Config, n Network) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.members[cfg.Id] = cfg
+	c.networks[cfg.Id] = n
+}
+
+func (c *Coordinator) send(id uint64, messageType uint8, dest uint64, uid uint32, data Size) (Size, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.strategy.Send(c, id, messageType, dest, uid, data)
+}
+
+func (c *Coordinator) receive(id uint64, messageType uint8, src uint64, uid uint32, data Size) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.strategy.Receive(c, id, messageType, src, uid, data)
+}
+
+// CollusionAdversary runs the honest protocol, but hands all messages to the strategy of the shared coordinator
+type CollusionAdversary struct {
+	interceptingAdversary
+	Strategy CollusionStrategy
+
+	coordinator *Coordinator
+}
+
+var _ Adversary = (*CollusionAdversary)(nil)
+var _ Colluding = (*CollusionAdversary)(nil)
+
+func (a *CollusionAdversary) Join(c *Coordinator) {
+	a.coordinator = c
+	c.use(a.Strategy)
+}
+
+func (a *CollusionAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	// Without a coordinator there is nobody to collude with
+	if a.coordinator == nil {
+		a.Join(NewCoordinator(cfg.Graph, cfg.F, []uint64{cfg.Id}))
+	}
+
+	a.coordinator.join(cfg, n)
+	a.init(honest, n, app, cfg, func(messageType uint8, dest uint64, uid uint32, data Size) (Size, bool) {
+		return a.coordinator.send(cfg.Id, messageType, dest, uid, data)
+	})
+}
+
+func (a *CollusionAdversary) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	a.coordinator.receive(a.cfg.Id, messageType, src, uid, data)
+	a.honest.Receive(messageType, src, uid, data)
+}
+
+// SplitReadyStrategy makes all Byzantine processes send their READY messages only to the same half of the correct
+// processes, in an attempt to make only that half deliver. With Bracha-Dolev, READY messages are only relayed by the
+// neighbours in that half.
+type SplitReadyStrategy struct {
+	targets map[uint64]struct{}
+}
+
+func (s *SplitReadyStrategy) Init(c *Coordinator) {
+	s.targets = make(map[uint64]struct{})
+	for _, n := range c.Correct[:len(c.Correct)/2] {
+		s.targets[n] = struct{}{}
+	}
+}
+
+func (s *SplitReadyStrategy) Send(_ *Coordinator, id uint64, messageType uint8, dest uint64, _ uint32, data Size) (Size, bool) {
+	if _, ok := s.targets[dest]; ok {
+		return data, true
+	}
+
+	if _, ok := data.(BrachaMessage); ok {
+		return data, messageType != BrachaReady
+	}
+
+	return dropReady(id, data)
+}
+
+func (s *SplitReadyStrategy) Receive(*Coordinator, uint64, uint8, uint64, uint32, Size) {}
+
+// dropReady removes the READY messages of Bracha process id from a Bracha-Dolev message
+func dropReady(id uint64, data Size) (Size, bool) {
+	dm, ok := data.(DolevKnownImprovedMessage)
+	if !ok {
+		return data, true
+	}
+
+	switch m := dm.Payload.(type) {
+	case brachaWrapper:
+		return data, dm.Src != id || m.messageType != BrachaReady
+	case BrachaDolevWrapperMsg:
+		msgs := make([]BrachaDolevMessage, 0, len(m.Msgs))
+		for _, bm := range m.Msgs {
+			if bm.Src != id || bm.Type != BrachaReady {
+				msgs = append(msgs, bm)
+			}
+		}
+
+		m.Msgs = msgs
+		dm.Payload = m
+		return dm, len(msgs) > 0
+	default:
+		return data, true
+	}
+}
+
+// AlignPathsStrategy makes all Byzantine relays forge the same payload, and claims paths for it that avoid the
+// nodes claimed by the other relays. Combined, the forged paths look like disjoint paths from the origin.
+type AlignPathsStrategy struct {
+	claimed map[uint64]map[uint64]bool
+}
+
+func (a *AlignPathsStrategy) Init(*Coordinator) {
+	a.claimed = make(map[uint64]map[uint64]bool)
+}
+
+func (a *AlignPathsStrategy) Send(c *Coordinator, id uint64, _ uint8, dest uint64, _ uint32, data Size) (Size, bool) {
+	cfg := c.Config(id)
+	data = mapPayload(data, func(p Size) Size {
+		return EquivocatedPayload{Original: p}
+	})
+
+	return mapPaths(data, func(p algo.DolevPath) []algo.DolevPath {
+		if len(p.Actual) == 0 {
+			return []algo.DolevPath{p}
+		}
+
+		actual := a.align(cfg, uint64(p.Actual[0].From().ID()), dest, len(p.Actual)+1)
+		if actual == nil {
+			return []algo.DolevPath{p}
+		}
+
+		fp := algo.DolevPath{Actual: actual, Prio: p.Prio}
+		if len(p.Desired) > len(p.Actual) {
+			fp.Desired = append(append(make(graphs.Path, 0, len(p.Desired)), actual...), p.Desired[len(p.Actual):]...)
+		}
+
+		return []algo.DolevPath{fp}
+	}), true
+}
+
+func (a *AlignPathsStrategy) Receive(*Coordinator, uint64, uint8, uint64, uint32, Size) {}
+
+// align claims a path from origin to process cfg.Id that does not use any node claimed before for this origin
+func (a *AlignPathsStrategy) align(cfg Config, origin, dest uint64, maxHops int) graphs.Path {
+	claimed, ok := a.claimed[origin]
+	if !ok {
+		claimed = make(map[uint64]bool)
+		a.claimed[origin] = claimed
+	}
+
+	free := func(p graphs.Path) bool {
+		for _, e := range p[:len(p)-1] {
+			if claimed[uint64(e.To().ID())] {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var res graphs.Path
+	if cfg.OptimizationConfig.DolevImplicitPath {
+		for _, p := range plannedPrefixes(cfg, origin, dest) {
+			if len(p) > 0 && free(p) {
+				res = p
+				break
+			}
+		}
+	} else {
+		avoid := map[uint64]bool{dest: true}
+		for n := range claimed {
+			avoid[n] = true
+		}
+
+		res = walk(cfg.random(), cfg.Graph, origin, cfg.Id, avoid, maxHops)
+	}
+
+	if res == nil {
+		// All options are exhausted, start over
+		a.claimed[origin] = make(map[uint64]bool)
+		return nil
+	}
+
+	for _, e := range res[:len(res)-1] {
+		claimed[uint64(e.To().ID())] = true
+	}
+
+	return res
+}
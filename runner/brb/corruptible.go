@@ -0,0 +1,142 @@
+package brb
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Corruptible runs an honest protocol, which can be handed over to an adversary at any time (adaptive corruption).
+// The adversary takes over the running protocol instance, so all state accumulated so far is kept.
+type Corruptible struct {
+	Honest Protocol
+
+	n   Network
+	app Application
+	cfg Config
+
+	net     *switchingNetwork
+	deliver *switchingApplication
+	adv     Adversary
+}
+
+var _ Protocol = (*Corruptible)(nil)
+
+func (c *Corruptible) Init(n Network, app Application, cfg Config) {
+	c.n, c.app, c.cfg = n, app, cfg
+	c.net = &switchingNetwork{target: n}
+	c.deliver = &switchingApplication{target: app}
+
+	c.Honest.Init(c.net, c.deliver, cfg)
+}
+
+// Corrupt hands control over the honest protocol to adv, must be called from the same routine as Receive/Broadcast
+func (c *Corruptible) Corrupt(adv Adversary) {
+	if c.adv != nil {
+		return
+	}
+
+	if !c.cfg.Silent {
+		fmt.Printf("process %v has been corrupted (%v running %v)\n", c.cfg.Id,
+			reflect.TypeOf(adv).Elem().Name(), reflect.TypeOf(c.Honest).Elem().Name())
+	}
+
+	// Deliveries of the (now Byzantine) honest protocol are of no interest anymore
+	c.deliver.set(byzantineApplication{})
+	c.adv = adv
+
+	adv.Init(runningProtocol{c}, c.n, byzantineApplication{}, c.cfg)
+}
+
+// Corrupted returns whether the process has been corrupted
+func (c *Corruptible) Corrupted() bool {
+	return c.adv != nil
+}
+
+func (c *Corruptible) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	if c.adv != nil {
+		c.adv.Receive(messageType, src, uid, data)
+	} else {
+		c.Honest.Receive(messageType, src, uid, data)
+	}
+}
+
+func (c *Corruptible) Broadcast(uid uint32, payload Size, bc BroadcastInfo) {
+	if c.adv != nil {
+		c.adv.Broadcast(uid, payload, bc)
+	} else {
+		c.Honest.Broadcast(uid, payload, bc)
+	}
+}
+
+func (c *Corruptible) Category() ProtocolCategory {
+	return c.Honest.Category()
+}
+
+// runningProtocol is handed to the adversary instead of an uninitialized honest protocol, initializing it only
+// redirects the network and application of the already running protocol
+type runningProtocol struct {
+	c *Corruptible
+}
+
+func (r runningProtocol) Init(n Network, app Application, _ Config) {
+	r.c.net.set(n)
+	r.c.deliver.set(app)
+}
+
+func (r runningProtocol) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	r.c.Honest.Receive(messageType, src, uid, data)
+}
+
+func (r runningProtocol) Broadcast(uid uint32, payload Size, bc BroadcastInfo) {
+	r.c.Honest.Broadcast(uid, payload, bc)
+}
+
+func (r runningProtocol) Category() ProtocolCategory {
+	return r.c.Honest.Category()
+}
+
+type switchingNetwork struct {
+	target Network
+	lock   sync.RWMutex
+}
+
+func (s *switchingNetwork) set(n Network) {
+	s.lock.Lock()
+	s.target = n
+	s.lock.Unlock()
+}
+
+func (s *switchingNetwork) get() Network {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.target
+}
+
+func (s *switchingNetwork) Send(messageType uint8, dest uint64, uid uint32, data Size, bc BroadcastInfo) {
+	s.get().Send(messageType, dest, uid, data, bc)
+}
+
+func (s *switchingNetwork) TriggerStat(uid uint32, n NetworkStat) {
+	s.get().TriggerStat(uid, n)
+}
+
+type switchingApplication struct {
+	target Application
+	lock   sync.RWMutex
+}
+
+func (s *switchingApplication) set(app Application) {
+	s.lock.Lock()
+	s.target = app
+	s.lock.Unlock()
+}
+
+func (s *switchingApplication) Deliver(uid uint32, payload Size, src uint64) {
+	s.lock.RLock()
+	target := s.target
+	s.lock.RUnlock()
+
+	target.Deliver(uid, payload, src)
+}
@@ -0,0 +1,179 @@
+package brb
+
+import (
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+)
+
+// Messages can be sent by Byzantine processes, so nothing about their contents can be assumed. The decode functions
+// check the type and contents of a received message, malformed messages are dropped by the protocols and counted
+// using the MalformedMessage statistic.
+
+// validPayload returns whether a payload can be handled, payloads are hashed and measured by all protocols. Payloads
+// can be protocol messages themselves, which are only valid when all their nested payloads are.
+func validPayload(p Size) bool {
+	switch m := p.(type) {
+	case nil:
+		return false
+	case EquivocatedPayload:
+		return m.Original == nil || validPayload(m.Original)
+	case BrachaMessage:
+		return validPayload(m.Payload)
+	case brachaWrapper:
+		return validPayload(m.msg)
+	case DolevMessage:
+		return validPayload(m.Payload)
+	case DolevKnownMessage:
+		return validPayload(m.Payload)
+	case DolevUnicastMessage:
+		return validPayload(m.Payload)
+	case DolevKnownImprovedMessage:
+		return validPayload(m.Payload)
+	case DolevWrapperMessage:
+		return validPayload(m.Payload)
+	case BrachaDolevWrapperMsg:
+		return validPayload(m.OriginalPayload)
+	case QuorumCertificate:
+		return validPayload(m.Payload)
+	default:
+		return true
+	}
+}
+
+// validEdges returns whether all edges of a path are complete
+func validEdges(p graphs.Path) bool {
+	for _, e := range p {
+		if e == nil || e.From() == nil || e.To() == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNeighbour(cfg Config, id uint64) bool {
+	for _, n := range cfg.Neighbours {
+		if n == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validDolevPath returns whether a path received by process cfg.Id can be relayed, the next hop of the desired path
+// (if any) should start at the process and go to one of its neighbours
+func validDolevPath(cfg Config, p algo.DolevPath) bool {
+	if !validEdges(p.Actual) || !validEdges(p.Desired) {
+		return false
+	}
+
+	// The actual path is extended by the receiving process, so the next hop is one further
+	if next := len(p.Actual) + 1; len(p.Desired) > next {
+		e := p.Desired[next]
+		return uint64(e.From().ID()) == cfg.Id && isNeighbour(cfg, uint64(e.To().ID()))
+	}
+
+	return true
+}
+
+func validDolevPaths(cfg Config, paths []algo.DolevPath) bool {
+	for _, p := range paths {
+		if !validDolevPath(cfg, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func decodeBracha(messageType uint8, data Size) (BrachaMessage, bool) {
+	m, ok := data.(BrachaMessage)
+	if !ok || messageType < BrachaSend || messageType > BrachaReply {
+		return BrachaMessage{}, false
+	}
+
+	return m, validPayload(m.Payload)
+}
+
+func decodeBrachaWrapper(payload Size) (brachaWrapper, bool) {
+	w, ok := payload.(brachaWrapper)
+	if !ok {
+		return brachaWrapper{}, false
+	}
+
+	_, ok = decodeBracha(w.messageType, w.msg)
+	return w, ok
+}
+
+func decodeDolev(data Size) (DolevMessage, bool) {
+	m, ok := data.(DolevMessage)
+	if !ok || !validEdges(m.Path) || !validPayload(m.Payload) {
+		return DolevMessage{}, false
+	}
+
+	return m, true
+}
+
+func decodeDolevKnown(cfg Config, data Size) (DolevKnownMessage, bool) {
+	m, ok := data.(DolevKnownMessage)
+	if !ok || !validDolevPath(cfg, m.Path) || !validPayload(m.Payload) {
+		return DolevKnownMessage{}, false
+	}
+
+	return m, true
+}
+
+func decodeDolevUnicast(cfg Config, data Size) (DolevUnicastMessage, bool) {
+	m, ok := data.(DolevUnicastMessage)
+	if !ok || !validDolevPath(cfg, m.Path) || !validPayload(m.Payload) {
+		return DolevUnicastMessage{}, false
+	}
+
+	return m, true
+}
+
+// decodeDolevKnownImproved checks the message and all merged messages it contains, when used by Bracha-Dolev (bd) all
+// payloads should be Bracha messages
+func decodeDolevKnownImproved(cfg Config, bd bool, data Size) (DolevKnownImprovedMessage, bool) {
+	m, ok := data.(DolevKnownImprovedMessage)
+	if !ok || m.Src == cfg.Id || !validDolevPaths(cfg, m.Paths) {
+		return DolevKnownImprovedMessage{}, false
+	}
+
+	payload := m.Payload
+	switch w := m.Payload.(type) {
+	case BrachaDolevWrapperMsg:
+		if !bd {
+			return m, false
+		}
+
+		for _, bm := range w.Msgs {
+			if bm.Src == cfg.Id || bm.Type < BrachaSend || bm.Type > BrachaReply || !validDolevPaths(cfg, bm.Paths) {
+				return m, false
+			}
+		}
+
+		return m, validPayload(w.OriginalPayload)
+	case DolevWrapperMessage:
+		for _, dm := range w.Msgs {
+			if dm.Src == cfg.Id || !validDolevPaths(cfg, dm.Paths) {
+				return m, false
+			}
+		}
+
+		payload = w.Payload
+	}
+
+	if bd {
+		_, ok = decodeBrachaWrapper(payload)
+		return m, ok
+	}
+
+	switch payload.(type) {
+	case BrachaDolevWrapperMsg, DolevWrapperMessage:
+		return m, false
+	default:
+		return m, validPayload(payload)
+	}
+}
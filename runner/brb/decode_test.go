@@ -0,0 +1,297 @@
+package brb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/graph/simple"
+	"math/rand"
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+	"testing"
+)
+
+const fuzzN, fuzzF = 7, 2
+
+type fuzzPayload string
+
+func (f fuzzPayload) SizeOf() uintptr {
+	return uintptr(len(f))
+}
+
+// fuzzNetwork fails the test when a message is sent that would make a process exit, and counts malformed messages
+type fuzzNetwork struct {
+	t   *testing.T
+	cfg Config
+
+	malformed int
+}
+
+func (n *fuzzNetwork) Send(_ uint8, dest uint64, _ uint32, data Size, _ BroadcastInfo) {
+	if !isNeighbour(n.cfg, dest) {
+		n.t.Fatalf("process %v sent a message to %v, which is not a neighbour", n.cfg.Id, dest)
+	}
+
+	data.SizeOf()
+}
+
+func (n *fuzzNetwork) TriggerStat(_ uint32, stat NetworkStat) {
+	if stat == MalformedMessage {
+		n.malformed += 1
+	}
+}
+
+type fuzzApplication struct{}
+
+func (fuzzApplication) Deliver(uint32, Size, uint64) {}
+
+func fuzzEdge(r *rand.Rand) simple.WeightedEdge {
+	// Also uses nodes that are not part of the graph
+	e := simple.WeightedEdge{F: simple.Node(r.Intn(fuzzN + 2)), T: simple.Node(r.Intn(fuzzN + 2)), W: 1}
+
+	switch r.Intn(20) {
+	case 0:
+		e.F = nil
+	case 1:
+		e.T = nil
+	}
+
+	return e
+}
+
+func fuzzPath(r *rand.Rand) graphs.Path {
+	if r.Intn(5) == 0 {
+		return nil
+	}
+
+	res := make(graphs.Path, r.Intn(fuzzN))
+	for i := range res {
+		if r.Intn(30) > 0 {
+			res[i] = fuzzEdge(r)
+		}
+	}
+
+	return res
+}
+
+func fuzzDolevPaths(r *rand.Rand) []algo.DolevPath {
+	res := make([]algo.DolevPath, r.Intn(4))
+	for i := range res {
+		res[i] = algo.DolevPath{Desired: fuzzPath(r), Actual: fuzzPath(r), Prio: r.Intn(2) == 0}
+	}
+
+	return res
+}
+
+// fuzzSize creates a random (possibly nested) message, as could be sent by a Byzantine process
+func fuzzSize(r *rand.Rand, depth int) Size {
+	if depth <= 0 {
+		if r.Intn(10) == 0 {
+			return nil
+		}
+
+		return fuzzPayload("payload")
+	}
+
+	src, id := uint64(r.Intn(fuzzN+1)), uint32(r.Intn(3))
+	switch r.Intn(16) {
+	case 0:
+		return nil
+	case 1:
+		return BrachaMessage{Src: src, Id: id, Payload: fuzzSize(r, depth-1)}
+	case 2:
+		return brachaWrapper{messageType: uint8(r.Intn(5)), msg: fuzzSize(r, depth-1)}
+	case 3:
+		return DolevMessage{Src: src, Id: id, Path: fuzzPath(r), Payload: fuzzSize(r, depth-1)}
+	case 4:
+		return DolevKnownMessage{Src: src, Id: id, Payload: fuzzSize(r, depth-1)}
+	case 5:
+		return DolevKnownMessage{Src: src, Id: id, Path: algo.DolevPath{Desired: fuzzPath(r), Actual: fuzzPath(r)},
+			Payload: fuzzSize(r, depth-1)}
+	case 6:
+		return DolevKnownImprovedMessage{Src: src, Id: id, Paths: fuzzDolevPaths(r), Payload: fuzzSize(r, depth-1),
+			Partial: r.Intn(2) == 0}
+	case 7:
+		msgs := make([]dolevWrapperWrapper, r.Intn(3))
+		for i := range msgs {
+			msgs[i] = dolevWrapperWrapper{Src: uint64(r.Intn(fuzzN + 1)), Paths: fuzzDolevPaths(r)}
+		}
+
+		return DolevWrapperMessage{Msgs: msgs, Payload: fuzzSize(r, depth-1)}
+	case 8:
+		msgs := make([]BrachaDolevMessage, r.Intn(3))
+		for i := range msgs {
+			msgs[i] = BrachaDolevMessage{Src: uint64(r.Intn(fuzzN + 1)), Type: uint8(r.Intn(5)), Paths: fuzzDolevPaths(r)}
+		}
+
+		return BrachaDolevWrapperMsg{Msgs: msgs, OriginalSrc: src, OriginalId: id, OriginalPayload: fuzzSize(r, depth-1)}
+	case 9:
+		return EquivocatedPayload{Original: fuzzSize(r, depth-1), Variant: 1}
+	case 10:
+		return SignedEchoMessage{Src: src, Id: id, Signature: make([]byte, r.Intn(70))}
+	case 11:
+		c := QuorumCertificate{Src: src, Id: id, Payload: fuzzSize(r, depth-1)}
+		for i := r.Intn(fuzzN + 1); i > 0; i-- {
+			c.Signers = append(c.Signers, uint64(r.Intn(fuzzN+1)))
+			c.Signatures = append(c.Signatures, make([]byte, 64))
+		}
+
+		return c
+	case 12:
+		m := AvidMessage{Src: src, Id: id, Root: make([]byte, r.Intn(2)*32), Fragment: make([]byte, r.Intn(10))}
+		for i := r.Intn(4); i > 0; i-- {
+			m.Proof = append(m.Proof, make([]byte, 32))
+		}
+
+		return m
+	case 13:
+		d := PayloadDigest{Hash: MustHash(fuzzPayload("payload"))}
+		for i := r.Intn(3); i > 0; i-- {
+			d.Holders = append(d.Holders, uint64(r.Intn(fuzzN+1)))
+		}
+
+		return BrachaMessage{Src: src, Id: id, Payload: d}
+	case 14:
+		return DolevUnicastMessage{Src: src, Id: id, Path: algo.DolevPath{Desired: fuzzPath(r), Actual: fuzzPath(r)},
+			Payload: fuzzSize(r, depth-1)}
+	default:
+		return fuzzPayload("payload")
+	}
+}
+
+// fuzzProtocol lets a process receive random messages from a neighbour for a fixed set of seeds, it fails when the
+// process sends a message it should not or does not count clearly malformed messages
+func fuzzProtocol(t *testing.T, create func() Protocol, opt OptimizationConfig) {
+	g, err := graphs.FullyConnectedGenerator{}.Generate(fuzzN, fuzzN, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var table *algo.FullRoutingTable
+	if opt.DolevImplicitPath {
+		table, err = algo.BuildFullRoutingTable(g, 0, fuzzN, fuzzF, fuzzF*2+1, opt.DolevSingleHopNeighbour,
+			opt.DolevCombineNextHops, opt.DolevFilterSubpaths, create().Category() == BrachaDolevCat)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nodes, _ := graphs.Nodes(g)
+	keys, err := GenerateSignatureKeys(nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		messageType := uint8(seed % 6)
+		cfg := Config{
+			N:                  fuzzN,
+			F:                  fuzzF,
+			Id:                 0,
+			Graph:              g,
+			Silent:             true,
+			OptimizationConfig: opt,
+			Precomputed:        PrecomputedValues{FullTable: table},
+			Signing:            keys[0],
+		}
+
+		for i := 1; i < fuzzN; i++ {
+			cfg.Neighbours = append(cfg.Neighbours, uint64(i))
+		}
+
+		n := &fuzzNetwork{t: t, cfg: cfg}
+		p := create()
+		p.Init(n, fuzzApplication{}, cfg)
+
+		// Links are authenticated, so the source is always a neighbour
+		from := cfg.Neighbours[seed%int64(len(cfg.Neighbours))]
+		for i := 0; i < 20; i++ {
+			p.Receive(messageType, from, uint32(i%3), fuzzSize(r, 3))
+		}
+
+		// Messages without a payload are malformed for every protocol
+		for i, m := range []Size{nil, BrachaMessage{Src: from}} {
+			malformed := n.malformed
+			p.Receive(messageType, from, uint32(i), m)
+			assert.Equal(t, malformed+1, n.malformed, "seed %v: %#v is not counted as malformed", seed, m)
+		}
+	}
+}
+
+var allOptimizations = OptimizationConfig{
+	DolevFilterSubpaths:         true,
+	DolevSingleHopNeighbour:     true,
+	DolevCombineNextHops:        true,
+	DolevReusePaths:             true,
+	DolevRelayMerging:           true,
+	DolevPayloadMerging:         true,
+	DolevImplicitPath:           true,
+	BrachaImplicitEcho:          true,
+	BrachaMinimalSubset:         true,
+	BrachaDigest:                true,
+	BrachaDolevPartialBroadcast: true,
+	BrachaDolevMerge:            true,
+}
+
+func TestFuzzFlooding(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &Flooding{} }, OptimizationConfig{})
+}
+
+func TestFuzzDolev(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &Dolev{} }, OptimizationConfig{})
+}
+
+func TestFuzzDolevImproved(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &DolevImproved{} }, OptimizationConfig{})
+}
+
+func TestFuzzDolevUnknown(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &DolevUnknown{} }, OptimizationConfig{})
+}
+
+func TestFuzzDolevKnown(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &DolevKnown{} }, OptimizationConfig{})
+}
+
+func TestFuzzDolevKnownImproved(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &DolevKnownImproved{} }, OptimizationConfig{})
+}
+
+func TestFuzzDolevKnownImprovedOptimized(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &DolevKnownImproved{} }, allOptimizations)
+}
+
+func TestFuzzBracha(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &Bracha{} }, OptimizationConfig{})
+}
+
+func TestFuzzBrachaImproved(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &BrachaImproved{} }, allOptimizations)
+}
+
+func TestFuzzBrachaDolev(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &BrachaDolev{} }, OptimizationConfig{})
+}
+
+func TestFuzzBrachaDolevKnown(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &BrachaDolevKnown{} }, OptimizationConfig{})
+}
+
+func TestFuzzBrachaDolevKnownImproved(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &BrachaDolevKnownImproved{} }, OptimizationConfig{})
+}
+
+func TestFuzzBrachaDolevKnownImprovedOptimized(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &BrachaDolevKnownImproved{} }, allOptimizations)
+}
+
+func TestFuzzSignedEcho(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &SignedEcho{} }, OptimizationConfig{})
+}
+
+func TestFuzzSignedEchoDolev(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &SignedEchoDolev{} }, allOptimizations)
+}
+
+func TestFuzzAvid(t *testing.T) {
+	fuzzProtocol(t, func() Protocol { return &Avid{} }, OptimizationConfig{})
+}
@@ -2,7 +2,6 @@ package brb
 
 import (
 	"crypto/sha256"
-	"fmt"
 	"gonum.org/v1/gonum/graph/simple"
 	"reflect"
 	"rp-runner/graphs"
@@ -19,10 +18,12 @@ func (d DolevMessage) SizeOf() uintptr {
 	return reflect.TypeOf(d.Src).Size() + reflect.TypeOf(d.Id).Size() + d.Payload.SizeOf() + d.Path.SizeOf()
 }
 
+// dolevIdentifier identifies a broadcast by the fields a relay can not change without being detected, the tracking uid
+// is excluded as it can be set freely
 type dolevIdentifier struct {
-	Src            uint64
-	Id, TrackingId uint32
-	Hash           [sha256.Size]byte
+	Src  uint64
+	Id   uint32
+	Hash [sha256.Size]byte
 }
 
 // Original Dolev Protocol
@@ -35,6 +36,9 @@ type Dolev struct {
 
 	delivered map[dolevIdentifier]struct{}
 	paths     map[dolevIdentifier][]graphs.Path
+
+	// Uid of the first message received for every broadcast that is not delivered yet
+	tracking map[dolevIdentifier]uint32
 }
 
 var _ Protocol = (*Dolev)(nil)
@@ -45,10 +49,7 @@ func (d *Dolev) Init(n Network, app Application, cfg Config) {
 	d.cfg = cfg
 	d.delivered = make(map[dolevIdentifier]struct{})
 	d.paths = make(map[dolevIdentifier][]graphs.Path)
-
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Dolev Byzantine node\n", cfg.Id)
-	}
+	d.tracking = make(map[dolevIdentifier]uint32)
 }
 
 func (d *Dolev) send(uid uint32, m DolevMessage, to []uint64) {
@@ -61,13 +62,12 @@ func (d *Dolev) send(uid uint32, m DolevMessage, to []uint64) {
 }
 
 func (d *Dolev) Receive(_ uint8, src uint64, uid uint32, data Size) {
-	if d.cfg.Byz {
-		// TODO: better byzantine behaviour?
+	m, ok := decodeDolev(data)
+	if !ok {
+		d.n.TriggerStat(uid, MalformedMessage)
 		return
 	}
 
-	m := data.(DolevMessage)
-
 	traversed := make(map[uint64]struct{}, len(m.Path))
 	for _, e := range m.Path {
 		traversed[uint64(e.From().ID())] = struct{}{}
@@ -81,10 +81,9 @@ func (d *Dolev) Receive(_ uint8, src uint64, uid uint32, data Size) {
 
 	// Add paths to mem for this message
 	id := dolevIdentifier{
-		Src:        m.Src,
-		Id:         m.Id,
-		TrackingId: uid,
-		Hash:       MustHash(m.Payload),
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
 	}
 
 	// Send to neighbours (except origin)
@@ -97,14 +96,18 @@ func (d *Dolev) Receive(_ uint8, src uint64, uid uint32, data Size) {
 
 	if _, ok := d.delivered[id]; !ok {
 		d.paths[id] = append(d.paths[id], m.Path)
+		if _, ok := d.tracking[id]; !ok {
+			d.tracking[id] = uid
+		}
 
 		if graphs.VerifyDisjointPaths(d.paths[id], simple.Node(m.Src), simple.Node(d.cfg.Id), d.cfg.F+1) {
 			//fmt.Printf("proc %v is delivering %v at %v\n", d.cfg.Id, id, time.Now())
 			d.delivered[id] = struct{}{}
-			d.app.Deliver(uid, m.Payload, m.Src)
+			d.app.Deliver(d.tracking[id], m.Payload, m.Src)
 
 			// Memory cleanup
 			delete(d.paths, id)
+			delete(d.tracking, id)
 		}
 	}
 
@@ -113,10 +116,9 @@ func (d *Dolev) Receive(_ uint8, src uint64, uid uint32, data Size) {
 
 func (d *Dolev) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
 	id := dolevIdentifier{
-		Src:        d.cfg.Id,
-		Id:         d.cnt,
-		TrackingId: uid,
-		Hash:       MustHash(payload),
+		Src:  d.cfg.Id,
+		Id:   d.cnt,
+		Hash: MustHash(payload),
 	}
 
 	if _, ok := d.delivered[id]; !ok {
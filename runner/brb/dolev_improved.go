@@ -1,7 +1,6 @@
 package brb
 
 import (
-	"fmt"
 	"gonum.org/v1/gonum/graph/simple"
 	"rp-runner/graphs"
 )
@@ -17,6 +16,7 @@ type DolevImproved struct {
 	delivered           map[dolevIdentifier]struct{}
 	paths               map[dolevIdentifier][]graphs.Path
 	neighboursDelivered map[dolevIdentifier]map[uint64]struct{}
+	tracking            map[dolevIdentifier]uint32
 }
 
 var _ Protocol = (*DolevImproved)(nil)
@@ -28,10 +28,7 @@ func (d *DolevImproved) Init(n Network, app Application, cfg Config) {
 	d.delivered = make(map[dolevIdentifier]struct{})
 	d.paths = make(map[dolevIdentifier][]graphs.Path)
 	d.neighboursDelivered = make(map[dolevIdentifier]map[uint64]struct{})
-
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Dolev (improved) Byzantine node\n", cfg.Id)
-	}
+	d.tracking = make(map[dolevIdentifier]uint32)
 }
 
 func (d *DolevImproved) send(uid uint32, m DolevMessage, to []uint64) {
@@ -49,29 +46,30 @@ func (d *DolevImproved) hasDelivered(id dolevIdentifier) bool {
 	return ok
 }
 
-func (d *DolevImproved) deliver(uid uint32, id dolevIdentifier, m DolevMessage) {
+// deliver delivers a message using the uid of the first message received for it, as later ones may be replayed
+func (d *DolevImproved) deliver(id dolevIdentifier, m DolevMessage) {
 	if !d.hasDelivered(id) {
 		d.delivered[id] = struct{}{}
-		d.app.Deliver(uid, m.Payload, m.Src)
+		d.app.Deliver(d.tracking[id], m.Payload, m.Src)
 
 		// Memory cleanup
 		delete(d.paths, id)
 		delete(d.neighboursDelivered, id)
+		delete(d.tracking, id)
 	}
 }
 
 func (d *DolevImproved) Receive(_ uint8, src uint64, uid uint32, data Size) {
-	if d.cfg.Byz {
-		// TODO: better byzantine behaviour?
+	m, ok := decodeDolev(data)
+	if !ok {
+		d.n.TriggerStat(uid, MalformedMessage)
 		return
 	}
 
-	m := data.(DolevMessage)
 	id := dolevIdentifier{
-		Src:        m.Src,
-		Id:         m.Id,
-		TrackingId: uid,
-		Hash:       MustHash(m.Payload),
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
 	}
 
 	// Modification 5: Stop processing message once delivered
@@ -79,8 +77,15 @@ func (d *DolevImproved) Receive(_ uint8, src uint64, uid uint32, data Size) {
 		return
 	}
 
+	// Own broadcasts are delivered immediately, so this message must have been forged
+	if d.cfg.Id == m.Src {
+		d.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
 	if _, ok := d.neighboursDelivered[id]; !ok {
 		d.neighboursDelivered[id] = make(map[uint64]struct{})
+		d.tracking[id] = uid
 	}
 
 	traversed := make(map[uint64]struct{}, len(m.Path))
@@ -121,12 +126,9 @@ func (d *DolevImproved) Receive(_ uint8, src uint64, uid uint32, data Size) {
 
 	// Modification 1: Deliver when receiving from source
 	if m.Src == src {
-		d.deliver(uid, id, m)
+		d.deliver(id, m)
 	}
 
-	if d.cfg.Id == m.Src {
-		panic("received message from self, should have been delivered already")
-	}
 	if uint64(m.Path[len(m.Path)-1].To().ID()) != d.cfg.Id {
 		panic("invalid message path")
 	}
@@ -136,7 +138,7 @@ func (d *DolevImproved) Receive(_ uint8, src uint64, uid uint32, data Size) {
 		d.paths[id] = append(d.paths[id], m.Path)
 
 		if graphs.VerifyDisjointPaths(d.paths[id], simple.Node(m.Src), simple.Node(d.cfg.Id), d.cfg.F+1) {
-			d.deliver(uid, id, m)
+			d.deliver(id, m)
 		}
 	}
 
@@ -162,10 +164,9 @@ func (d *DolevImproved) Receive(_ uint8, src uint64, uid uint32, data Size) {
 
 func (d *DolevImproved) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
 	id := dolevIdentifier{
-		Src:        d.cfg.Id,
-		Id:         d.cnt,
-		TrackingId: uid,
-		Hash:       MustHash(payload),
+		Src:  d.cfg.Id,
+		Id:   d.cnt,
+		Hash: MustHash(payload),
 	}
 
 	if _, ok := d.delivered[id]; !ok {
@@ -31,6 +31,7 @@ type DolevKnown struct {
 
 	delivered map[dolevIdentifier]struct{}
 	paths     map[dolevIdentifier][]graphs.Path
+	tracking  map[dolevIdentifier]uint32
 
 	broadcast algo.BroadcastPlan
 }
@@ -43,11 +44,7 @@ func (d *DolevKnown) Init(n Network, app Application, cfg Config) {
 	d.cfg = cfg
 	d.delivered = make(map[dolevIdentifier]struct{})
 	d.paths = make(map[dolevIdentifier][]graphs.Path)
-
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Dolev Byzantine node\n", cfg.Id)
-		return
-	}
+	d.tracking = make(map[dolevIdentifier]uint32)
 
 	if d.broadcast == nil && !d.cfg.Unused {
 		routes, err := algo.BuildRoutingTable(cfg.Graph, graphs.Node{
@@ -99,19 +96,17 @@ func (d *DolevKnown) hasDelivered(id dolevIdentifier) bool {
 }
 
 func (d *DolevKnown) Receive(_ uint8, src uint64, uid uint32, data Size) {
-	if d.cfg.Byz {
-		// TODO: better byzantine behaviour?
+	m, ok := decodeDolevKnown(d.cfg, data)
+	if !ok {
+		d.n.TriggerStat(uid, MalformedMessage)
 		return
 	}
 
-	m := data.(DolevKnownMessage)
-
 	// Add paths to mem for this message
 	id := dolevIdentifier{
-		Src:        m.Src,
-		Id:         m.Id,
-		TrackingId: uid,
-		Hash:       MustHash(m.Payload),
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
 	}
 
 	// Add latest edge to path for message
@@ -122,6 +117,11 @@ func (d *DolevKnown) Receive(_ uint8, src uint64, uid uint32, data Size) {
 
 	if !d.hasDelivered(id) {
 		d.paths[id] = append(d.paths[id], m.Path.Actual)
+
+		// Replayed messages can have a different uid, so the first one is used when delivering
+		if _, ok := d.tracking[id]; !ok {
+			d.tracking[id] = uid
+		}
 	}
 
 	// Send to next hops
@@ -130,20 +130,20 @@ func (d *DolevKnown) Receive(_ uint8, src uint64, uid uint32, data Size) {
 	if !d.hasDelivered(id) {
 		if graphs.VerifyDisjointPaths(d.paths[id], simple.Node(m.Src), simple.Node(d.cfg.Id), d.cfg.F+1) {
 			d.delivered[id] = struct{}{}
-			d.app.Deliver(uid, m.Payload, m.Src)
+			d.app.Deliver(d.tracking[id], m.Payload, m.Src)
 
 			// Memory cleanup
 			delete(d.paths, id)
+			delete(d.tracking, id)
 		}
 	}
 }
 
 func (d *DolevKnown) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
 	id := dolevIdentifier{
-		Src:        d.cfg.Id,
-		Id:         d.cnt,
-		TrackingId: uid,
-		Hash:       MustHash(payload),
+		Src:  d.cfg.Id,
+		Id:   d.cnt,
+		Hash: MustHash(payload),
 	}
 
 	if _, ok := d.delivered[id]; !ok {
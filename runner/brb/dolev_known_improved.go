@@ -2,7 +2,6 @@ package brb
 
 import (
 	"crypto/sha256"
-	"fmt"
 	"gonum.org/v1/gonum/graph/simple"
 	"reflect"
 	"rp-runner/brb/algo"
@@ -36,9 +35,13 @@ type DolevKnownImproved struct {
 
 	cnt uint32
 
-	delivered map[dolevIdentifier]struct{}
+	// Delivered broadcasts with the uid they were delivered with
+	delivered map[dolevIdentifier]uint32
 	paths     map[dolevIdentifier][]graphs.Path
 
+	// Tracking uid of the first message received for every broadcast that is not delivered yet
+	tracking map[dolevIdentifier]uint32
+
 	buffer        map[dolevIdentifier][]algo.DolevPath
 	partialBuffer map[dolevIdentifier][]algo.DolevPath
 
@@ -59,19 +62,15 @@ func (d *DolevKnownImproved) Init(n Network, app Application, cfg Config) {
 	d.n = n
 	d.app = app
 	d.cfg = cfg
-	d.delivered = make(map[dolevIdentifier]struct{})
+	d.delivered = make(map[dolevIdentifier]uint32)
 	d.paths = make(map[dolevIdentifier][]graphs.Path)
+	d.tracking = make(map[dolevIdentifier]uint32)
 	d.buffer = make(map[dolevIdentifier][]algo.DolevPath)
 	d.partialBuffer = make(map[dolevIdentifier][]algo.DolevPath)
 	d.implicitPathsUsed = make(map[dolevIdentifier][]algo.DolevPath)
 	d.bdBuffer = make(map[brachaIdentifier][]bdBufferEntry)
 	d.similarPayloads = make(map[[sha256.Size]byte]map[dolevIdentifier]struct{})
 
-	if !cfg.Silent && cfg.Byz {
-		fmt.Printf("process %v is a Dolev (known improved) Byzantine node\n", cfg.Id)
-		return
-	}
-
 	if d.broadcast == nil && !d.cfg.Unused {
 		_, bd := cfg.AdditionalConfig.(BrachaDolevConfig)
 		d.bd = bd
@@ -121,10 +120,9 @@ func (d *DolevKnownImproved) sendMergedBDMessage(uid uint32, m BrachaDolevWrappe
 	}
 	hopping := false
 	bid := brachaIdentifier{
-		Src:        m.OriginalSrc,
-		Id:         m.OriginalId,
-		TrackingId: uid,
-		Hash:       MustHash(m.OriginalPayload),
+		Src:  m.OriginalSrc,
+		Id:   m.OriginalId,
+		Hash: MustHash(m.OriginalPayload),
 	}
 
 	// When a certain combination of optimizations is enabled, some special care needs to be taken as to not
@@ -137,10 +135,9 @@ func (d *DolevKnownImproved) sendMergedBDMessage(uid uint32, m BrachaDolevWrappe
 		var paths []algo.DolevPath
 
 		id := dolevIdentifier{
-			Src:        dm.Src,
-			Id:         dm.Id,
-			TrackingId: uid,
-			Hash:       MustHash(dm.Payload),
+			Src:  dm.Src,
+			Id:   dm.Id,
+			Hash: MustHash(dm.Payload),
 		}
 
 		del := d.hasDelivered(id)
@@ -353,7 +350,7 @@ func (d *DolevKnownImproved) sendMergedPayload(uid uint32, bufferCnt map[uint64]
 					msgs = append(msgs, dolevWrapperWrapper{
 						Src:        hopper.id.Src,
 						Id:         hopper.id.Id,
-						TrackingId: hopper.id.TrackingId,
+						TrackingId: d.trackingId(hopper.id),
 						Paths:      p,
 					})
 				}
@@ -389,10 +386,9 @@ func (d *DolevKnownImproved) sendMergedPayload(uid uint32, bufferCnt map[uint64]
 
 func (d *DolevKnownImproved) sendMergedMessage(uid uint32, m DolevKnownImprovedMessage) {
 	id := dolevIdentifier{
-		Src:        m.Src,
-		Id:         m.Id,
-		TrackingId: uid,
-		Hash:       MustHash(m.Payload),
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
 	}
 	del := d.hasDelivered(id)
 
@@ -521,6 +517,16 @@ func (d *DolevKnownImproved) hasDelivered(id dolevIdentifier) bool {
 	return ok
 }
 
+// trackingId returns the uid of the first message received for a broadcast, delivered broadcasts keep the uid they
+// were delivered with
+func (d *DolevKnownImproved) trackingId(id dolevIdentifier) uint32 {
+	if uid, ok := d.delivered[id]; ok {
+		return uid
+	}
+
+	return d.tracking[id]
+}
+
 func (d *DolevKnownImproved) checkPayloadSimilarity(id dolevIdentifier) {
 	if _, ok := d.similarPayloads[id.Hash]; !ok {
 		d.similarPayloads[id.Hash] = make(map[dolevIdentifier]struct{})
@@ -530,12 +536,12 @@ func (d *DolevKnownImproved) checkPayloadSimilarity(id dolevIdentifier) {
 }
 
 func (d *DolevKnownImproved) Receive(_ uint8, src uint64, uid uint32, data Size) {
-	if d.cfg.Byz {
-		// TODO: better byzantine behaviour?
+	dm, ok := decodeDolevKnownImproved(d.cfg, d.bd, data)
+	if !ok {
+		d.n.TriggerStat(uid, MalformedMessage)
 		return
 	}
 
-	dm := data.(DolevKnownImprovedMessage)
 	bdw, bdWrapperOk := dm.Payload.(BrachaDolevWrapperMsg)
 	dpw, dpWrapperOk := dm.Payload.(DolevWrapperMessage)
 	msgs := []DolevKnownImprovedMessage{dm}
@@ -562,10 +568,13 @@ func (d *DolevKnownImproved) Receive(_ uint8, src uint64, uid uint32, data Size)
 		}
 
 		id := dolevIdentifier{
-			Src:        m.Src,
-			Id:         m.Id,
-			TrackingId: track,
-			Hash:       MustHash(m.Payload),
+			Src:  m.Src,
+			Id:   m.Id,
+			Hash: MustHash(m.Payload),
+		}
+
+		if _, ok := d.tracking[id]; !ok && !d.hasDelivered(id) {
+			d.tracking[id] = track
 		}
 
 		if d.cfg.OptimizationConfig.DolevPayloadMerging {
@@ -594,11 +603,12 @@ func (d *DolevKnownImproved) Receive(_ uint8, src uint64, uid uint32, data Size)
 			// Additional modification (based on bonomi 7): Accept messages from origin immediately
 			if m.Src == src || graphs.VerifyDisjointPaths(d.paths[id], simple.Node(m.Src), simple.Node(d.cfg.Id), d.cfg.F+1) {
 				//fmt.Printf("proc %v is delivering %v at %v\n", d.cfg.Id, id, time.Now())
-				d.delivered[id] = struct{}{}
-				d.app.Deliver(track, m.Payload, m.Src)
+				d.delivered[id] = d.tracking[id]
+				d.app.Deliver(d.tracking[id], m.Payload, m.Src)
 
 				// Memory cleanup
 				d.paths[id] = nil
+				delete(d.tracking, id)
 			}
 		}
 	}
@@ -635,14 +645,13 @@ func (d *DolevKnownImproved) Receive(_ uint8, src uint64, uid uint32, data Size)
 
 func (d *DolevKnownImproved) Broadcast(uid uint32, payload Size, bc BroadcastInfo) {
 	id := dolevIdentifier{
-		Src:        d.cfg.Id,
-		Id:         d.cnt,
-		TrackingId: uid,
-		Hash:       MustHash(payload),
+		Src:  d.cfg.Id,
+		Id:   d.cnt,
+		Hash: MustHash(payload),
 	}
 
 	if _, ok := d.delivered[id]; !ok {
-		d.delivered[id] = struct{}{}
+		d.delivered[id] = uid
 		d.paths[id] = make([]graphs.Path, d.cfg.F*2+1)
 		d.app.Deliver(uid, payload, d.cfg.Id)
 
@@ -0,0 +1,112 @@
+package brb
+
+import (
+	"fmt"
+	"gonum.org/v1/gonum/graph/simple"
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+)
+
+// DolevUnicastMessage is relayed like a DolevKnownMessage, but only the last process of its path delivers it
+type DolevUnicastMessage DolevKnownMessage
+
+func (d DolevUnicastMessage) SizeOf() uintptr {
+	return DolevKnownMessage(d).SizeOf()
+}
+
+// dolevUnicast sends messages to a single process of a partially connected network, over 2f+1 disjoint paths like
+// DolevKnown does for every process. The destination delivers a message once it is received over f+1 disjoint paths,
+// or directly from its source.
+type dolevUnicast struct {
+	n   Network
+	cfg Config
+
+	cnt uint32
+
+	graph  *simple.WeightedDirectedGraph
+	routes map[uint64][]graphs.Path
+
+	delivered map[dolevIdentifier]struct{}
+	paths     map[dolevIdentifier][]graphs.Path
+}
+
+func (u *dolevUnicast) Init(n Network, cfg Config) {
+	u.n = n
+	u.cfg = cfg
+	u.routes = make(map[uint64][]graphs.Path)
+	u.delivered = make(map[dolevIdentifier]struct{})
+	u.paths = make(map[dolevIdentifier][]graphs.Path)
+}
+
+// route returns the disjoint paths to dest, only the direct edge is used for neighbours
+func (u *dolevUnicast) route(dest uint64) []graphs.Path {
+	if paths, ok := u.routes[dest]; ok {
+		return paths
+	}
+
+	if u.graph == nil {
+		u.graph = graphs.Directed(u.cfg.Graph)
+	}
+
+	paths, err := graphs.DisjointPaths(u.graph, nil, simple.Node(u.cfg.Id), simple.Node(dest), u.cfg.F*2+1, nil, true)
+	if err != nil {
+		panic(fmt.Sprintf("process %v errored while finding paths to %v: %v\n", u.cfg.Id, dest, err))
+	}
+
+	u.routes[dest] = paths
+	return paths
+}
+
+func (u *dolevUnicast) Send(uid uint32, dest uint64, payload Size) {
+	m := DolevUnicastMessage{
+		Src:     u.cfg.Id,
+		Id:      u.cnt,
+		Payload: payload,
+	}
+	u.cnt += 1
+
+	for _, p := range u.route(dest) {
+		m.Path = algo.DolevPath{Desired: p}
+		u.n.Send(0, uint64(p[0].To().ID()), uid, m, BroadcastInfo{})
+	}
+}
+
+// Receive relays a message to its next hop, it returns the message once it is delivered to this process
+func (u *dolevUnicast) Receive(src uint64, uid uint32, data Size) (DolevUnicastMessage, bool) {
+	m, ok := decodeDolevUnicast(u.cfg, data)
+	if !ok || m.Src == u.cfg.Id {
+		u.n.TriggerStat(uid, MalformedMessage)
+		return DolevUnicastMessage{}, false
+	}
+
+	m.Path.Actual = append(m.Path.Actual, simple.WeightedEdge{
+		F: simple.Node(src),
+		T: simple.Node(u.cfg.Id),
+	})
+
+	if cur := len(m.Path.Actual); len(m.Path.Desired) > cur {
+		u.n.TriggerStat(uid, StartRelay)
+		u.n.Send(0, uint64(m.Path.Desired[cur].To().ID()), uid, m, BroadcastInfo{})
+		return DolevUnicastMessage{}, false
+	}
+
+	id := dolevIdentifier{
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
+	}
+
+	if _, ok := u.delivered[id]; ok {
+		return DolevUnicastMessage{}, false
+	}
+	u.paths[id] = append(u.paths[id], m.Path.Actual)
+
+	if m.Src != src && !graphs.VerifyDisjointPaths(u.paths[id], simple.Node(m.Src), simple.Node(u.cfg.Id), u.cfg.F+1) {
+		return DolevUnicastMessage{}, false
+	}
+
+	u.delivered[id] = struct{}{}
+	delete(u.paths, id)
+
+	return m, true
+}
@@ -0,0 +1,218 @@
+package brb
+
+import (
+	"gonum.org/v1/gonum/graph/simple"
+	"rp-runner/graphs"
+)
+
+// dolevUnknownPath is a received path, with the nodes it traversed (excluding the source)
+type dolevUnknownPath struct {
+	path  graphs.Path
+	nodes map[int64]struct{}
+}
+
+// contains returns whether all nodes of o are traversed by p
+func (p dolevUnknownPath) contains(o dolevUnknownPath) bool {
+	if len(o.nodes) > len(p.nodes) {
+		return false
+	}
+
+	for n := range o.nodes {
+		if _, ok := p.nodes[n]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DolevUnknown is Dolev for unknown topologies with the modifications of Bonomi et al.: processes deliver directly
+// when receiving from the source (MD.1), relay an empty path once delivered (MD.2), do not relay to neighbours that
+// delivered (MD.3), ignore paths through processes that delivered (MD.4) and stop relaying after delivering (MD.5).
+// Paths that traverse all nodes of another received path are pruned, as they can not add a disjoint path.
+type DolevUnknown struct {
+	n   Network
+	app Application
+	cfg Config
+
+	cnt uint32
+
+	delivered           map[dolevIdentifier]struct{}
+	paths               map[dolevIdentifier][]dolevUnknownPath
+	neighboursDelivered map[dolevIdentifier]map[uint64]struct{}
+	tracking            map[dolevIdentifier]uint32
+}
+
+var _ Protocol = (*DolevUnknown)(nil)
+
+func (d *DolevUnknown) Init(n Network, app Application, cfg Config) {
+	d.n = n
+	d.app = app
+	d.cfg = cfg
+	d.delivered = make(map[dolevIdentifier]struct{})
+	d.paths = make(map[dolevIdentifier][]dolevUnknownPath)
+	d.neighboursDelivered = make(map[dolevIdentifier]map[uint64]struct{})
+	d.tracking = make(map[dolevIdentifier]uint32)
+}
+
+func (d *DolevUnknown) send(uid uint32, m DolevMessage, to []uint64) {
+	for _, n := range to {
+		path := make(graphs.Path, len(m.Path))
+		copy(path, m.Path)
+		m.Path = path
+		d.n.Send(0, n, uid, m, BroadcastInfo{})
+		d.n.TriggerStat(uid, StartRelay)
+	}
+}
+
+func (d *DolevUnknown) hasDelivered(id dolevIdentifier) bool {
+	_, ok := d.delivered[id]
+	return ok
+}
+
+// deliver delivers a message with the uid of the first message received for it, and relays it with an empty path to
+// all neighbours that did not deliver yet
+func (d *DolevUnknown) deliver(id dolevIdentifier, m DolevMessage) {
+	uid := d.tracking[id]
+	d.delivered[id] = struct{}{}
+	d.app.Deliver(uid, m.Payload, m.Src)
+
+	to := make([]uint64, 0, len(d.cfg.Neighbours))
+	for _, n := range d.cfg.Neighbours {
+		if _, ok := d.neighboursDelivered[id][n]; !ok {
+			to = append(to, n)
+		}
+	}
+
+	m.Path = nil
+	d.send(uid, m, to)
+
+	// Memory cleanup
+	delete(d.paths, id)
+	delete(d.neighboursDelivered, id)
+	delete(d.tracking, id)
+}
+
+// store adds a path unless it traverses all nodes of a known path, known paths traversing all its nodes are removed
+func (d *DolevUnknown) store(id dolevIdentifier, p dolevUnknownPath) bool {
+	paths := d.paths[id]
+	for _, o := range paths {
+		if p.contains(o) {
+			return false
+		}
+	}
+
+	res := paths[:0]
+	for _, o := range paths {
+		if !o.contains(p) {
+			res = append(res, o)
+		}
+	}
+	d.paths[id] = append(res, p)
+
+	return true
+}
+
+func (d *DolevUnknown) Receive(_ uint8, src uint64, uid uint32, data Size) {
+	m, ok := decodeDolev(data)
+	if !ok {
+		d.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
+	id := dolevIdentifier{
+		Src:  m.Src,
+		Id:   m.Id,
+		Hash: MustHash(m.Payload),
+	}
+
+	// MD.5: Stop processing messages once delivered
+	if d.hasDelivered(id) {
+		return
+	}
+
+	// Own broadcasts are delivered immediately, so this message must have been forged
+	if d.cfg.Id == m.Src {
+		d.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
+	if _, ok := d.neighboursDelivered[id]; !ok {
+		d.neighboursDelivered[id] = make(map[uint64]struct{})
+		d.tracking[id] = uid
+	}
+
+	// MD.1: Deliver when receiving from the source
+	if src == m.Src {
+		if len(m.Path) > 0 {
+			d.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		d.neighboursDelivered[id][src] = struct{}{}
+		d.deliver(id, m)
+		return
+	}
+
+	// MD.2: An empty path is sent by a neighbour that delivered, which is equivalent to a direct link to the source
+	if len(m.Path) == 0 {
+		d.neighboursDelivered[id][src] = struct{}{}
+		m.Path = graphs.Path{simple.WeightedEdge{F: simple.Node(m.Src), T: simple.Node(src)}}
+	}
+
+	m.Path = append(m.Path, simple.WeightedEdge{F: simple.Node(src), T: simple.Node(d.cfg.Id)})
+	if !graphs.ValidPath(m.Path, simple.Node(m.Src), simple.Node(d.cfg.Id)) {
+		d.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
+	p := dolevUnknownPath{path: m.Path, nodes: make(map[int64]struct{}, len(m.Path))}
+	for _, e := range m.Path {
+		p.nodes[e.To().ID()] = struct{}{}
+	}
+	delete(p.nodes, int64(d.cfg.Id))
+
+	// MD.4: Paths through neighbours that delivered are ignored, the empty path of the neighbour is a subset
+	if !d.store(id, p) {
+		return
+	}
+
+	paths := make([]graphs.Path, 0, len(d.paths[id]))
+	for _, o := range d.paths[id] {
+		paths = append(paths, o.path)
+	}
+
+	if graphs.VerifyDisjointPaths(paths, simple.Node(m.Src), simple.Node(d.cfg.Id), d.cfg.F+1) {
+		d.deliver(id, m)
+		return
+	}
+
+	// MD.3: Do not relay to neighbours that delivered, or that were already traversed
+	to := make([]uint64, 0, len(d.cfg.Neighbours))
+	for _, n := range d.cfg.Neighbours {
+		_, traversed := p.nodes[int64(n)]
+		if _, ok := d.neighboursDelivered[id][n]; !ok && !traversed && n != m.Src {
+			to = append(to, n)
+		}
+	}
+
+	d.send(uid, m, to)
+}
+
+func (d *DolevUnknown) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
+	id := dolevIdentifier{
+		Src:  d.cfg.Id,
+		Id:   d.cnt,
+		Hash: MustHash(payload),
+	}
+	d.cnt += 1
+
+	d.delivered[id] = struct{}{}
+	d.app.Deliver(uid, payload, d.cfg.Id)
+
+	d.send(uid, DolevMessage{Src: id.Src, Id: id.Id, Payload: payload}, d.cfg.Neighbours)
+}
+
+func (d *DolevUnknown) Category() ProtocolCategory {
+	return DolevCat
+}
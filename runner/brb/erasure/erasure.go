@@ -0,0 +1,179 @@
+package erasure
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+)
+
+// MaxFragments is the maximum amount of fragments, every fragment is an evaluation at a different point of GF(2^8)
+const MaxFragments = 256
+
+// Arithmetic in GF(2^8) using the polynomial x^8 + x^4 + x^3 + x^2 + 1, with 2 as generator
+var expTable [510]byte
+var logTable [256]int
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = i
+
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return expTable[logTable[a]+logTable[b]]
+}
+
+func inv(a byte) byte {
+	return expTable[255-logTable[a]]
+}
+
+// row returns row i of the Vandermonde matrix with k columns, any k rows of this matrix are linearly independent
+func row(i, k int) []byte {
+	res := make([]byte, k)
+
+	x := byte(1)
+	for c := range res {
+		res[c] = x
+		x = mul(x, byte(i))
+	}
+
+	return res
+}
+
+// invert inverts a square matrix using Gauss-Jordan elimination
+func invert(m [][]byte) ([][]byte, error) {
+	k := len(m)
+
+	res := make([][]byte, k)
+	for i := range res {
+		res[i] = make([]byte, k)
+		res[i][i] = 1
+	}
+
+	for c := 0; c < k; c++ {
+		p := c
+		for p < k && m[p][c] == 0 {
+			p++
+		}
+		if p == k {
+			return nil, errors.New("matrix is singular")
+		}
+		m[c], m[p] = m[p], m[c]
+		res[c], res[p] = res[p], res[c]
+
+		scale := inv(m[c][c])
+		for j := 0; j < k; j++ {
+			m[c][j] = mul(m[c][j], scale)
+			res[c][j] = mul(res[c][j], scale)
+		}
+
+		for r := 0; r < k; r++ {
+			if f := m[r][c]; r != c && f != 0 {
+				for j := 0; j < k; j++ {
+					m[r][j] ^= mul(f, m[c][j])
+					res[r][j] ^= mul(f, res[c][j])
+				}
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Encode splits data into n fragments using a Reed-Solomon code, any k of them are enough to reconstruct the data
+func Encode(data []byte, k, n int) ([][]byte, error) {
+	if k < 1 || n < k || n > MaxFragments {
+		return nil, errors.Errorf("unable to encode %v fragments of which %v are needed", n, k)
+	}
+
+	// The length is prepended, so the padding of the last data shard can be removed
+	size := (4 + len(data) + k - 1) / k
+	padded := make([]byte, size*k)
+	binary.BigEndian.PutUint32(padded, uint32(len(data)))
+	copy(padded[4:], data)
+
+	res := make([][]byte, n)
+	for i := range res {
+		res[i] = make([]byte, size)
+		coefficients := row(i, k)
+
+		for c, f := range coefficients {
+			shard := padded[c*size : (c+1)*size]
+			for j, b := range shard {
+				res[i][j] ^= mul(f, b)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Decode reconstructs the data from the fragments created by Encode, missing fragments are nil. At least k fragments
+// of the same size are needed.
+func Decode(fragments [][]byte, k int) ([]byte, error) {
+	if k < 1 || len(fragments) > MaxFragments {
+		return nil, errors.New("invalid amount of fragments")
+	}
+
+	var indices []int
+	size := -1
+	for i, f := range fragments {
+		if f == nil || len(indices) == k {
+			continue
+		}
+
+		if size == -1 {
+			size = len(f)
+		} else if len(f) != size {
+			return nil, errors.New("fragments have different sizes")
+		}
+		indices = append(indices, i)
+	}
+
+	if len(indices) < k {
+		return nil, errors.Errorf("need %v fragments to decode, got %v", k, len(indices))
+	}
+
+	m := make([][]byte, k)
+	for r, i := range indices {
+		m[r] = row(i, k)
+	}
+
+	decode, err := invert(m)
+	if err != nil {
+		return nil, err
+	}
+
+	padded := make([]byte, size*k)
+	for c := 0; c < k; c++ {
+		shard := padded[c*size : (c+1)*size]
+		for r, i := range indices {
+			f := decode[c][r]
+			for j, b := range fragments[i] {
+				shard[j] ^= mul(f, b)
+			}
+		}
+	}
+
+	if len(padded) < 4 {
+		return nil, errors.New("fragments are too small")
+	}
+
+	length := binary.BigEndian.Uint32(padded)
+	if uint64(length) > uint64(len(padded)-4) {
+		return nil, errors.New("invalid length of decoded data")
+	}
+
+	return padded[4 : 4+length], nil
+}
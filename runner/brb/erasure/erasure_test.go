@@ -0,0 +1,69 @@
+package erasure
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestErasureDecode(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 200; i++ {
+		n := 1 + r.Intn(40)
+		k := 1 + r.Intn(n)
+
+		data := make([]byte, r.Intn(500))
+		r.Read(data)
+
+		fragments, err := Encode(data, k, n)
+		if err != nil {
+			t.Fatalf("unable to encode %v bytes in %v/%v fragments: %v", len(data), k, n, err)
+		}
+
+		// Only keep k random fragments
+		kept := make([][]byte, n)
+		indices := r.Perm(n)[:k]
+		for _, j := range indices {
+			kept[j] = fragments[j]
+		}
+
+		res, err := Decode(kept, k)
+		if err != nil {
+			t.Fatalf("unable to decode %v/%v fragments: %v", k, n, err)
+		}
+
+		if !bytes.Equal(data, res) {
+			t.Fatalf("decoded %x instead of %x", res, data)
+		}
+
+		kept[indices[r.Intn(k)]] = nil
+		if _, err := Decode(kept, k); err == nil {
+			t.Fatalf("decoded %v/%v fragments with a fragment missing", k, n)
+		}
+	}
+}
+
+func TestMerkleTree(t *testing.T) {
+	for n := 1; n < 20; n++ {
+		leaves := make([][]byte, n)
+		for i := range leaves {
+			leaves[i] = []byte{byte(i)}
+		}
+
+		root, proofs := MerkleTree(leaves)
+		for i, l := range leaves {
+			if !VerifyMerkle(root, i, n, l, proofs[i]) {
+				t.Fatalf("proof of leaf %v/%v is invalid", i, n)
+			}
+
+			if VerifyMerkle(root, i, n, []byte{0xff}, proofs[i]) {
+				t.Fatalf("proof of leaf %v/%v accepts a different leaf", i, n)
+			}
+
+			if n > 1 && VerifyMerkle(root, (i+1)%n, n, l, proofs[i]) {
+				t.Fatalf("proof of leaf %v/%v accepts a different index", i, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package erasure
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// Leaves and inner nodes are hashed with a different prefix, so a leaf can not be passed off as an inner node
+func leafHash(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(leaf)
+
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+
+	return h.Sum(nil)
+}
+
+// MerkleTree returns the root of the Merkle tree over all leaves, and a proof for every leaf. The last node of a level
+// with an odd amount of nodes is paired with itself.
+func MerkleTree(leaves [][]byte) ([]byte, [][][]byte) {
+	level := make([][]byte, len(leaves))
+	for i, l := range leaves {
+		level[i] = leafHash(l)
+	}
+
+	proofs := make([][][]byte, len(leaves))
+	positions := make([]int, len(leaves))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	for len(level) > 1 {
+		for i, p := range positions {
+			proofs[i] = append(proofs[i], level[sibling(p, len(level))])
+			positions[i] = p / 2
+		}
+
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, nodeHash(level[i], level[sibling(i, len(level))]))
+		}
+		level = next
+	}
+
+	if len(level) == 0 {
+		return nil, proofs
+	}
+
+	return level[0], proofs
+}
+
+func sibling(i, n int) int {
+	if i%2 == 1 {
+		return i - 1
+	} else if i+1 < n {
+		return i + 1
+	}
+
+	return i
+}
+
+// VerifyMerkle returns whether leaf is leaf index of the count leaves of the Merkle tree with the given root
+func VerifyMerkle(root []byte, index, count int, leaf []byte, proof [][]byte) bool {
+	if index < 0 || index >= count {
+		return false
+	}
+
+	depth := 0
+	for n := count; n > 1; n = (n + 1) / 2 {
+		depth++
+	}
+
+	if len(proof) != depth {
+		return false
+	}
+
+	h := leafHash(leaf)
+	for _, s := range proof {
+		if index%2 == 0 {
+			h = nodeHash(h, s)
+		} else {
+			h = nodeHash(s, h)
+		}
+		index /= 2
+	}
+
+	return bytes.Equal(h, root)
+}
@@ -1,7 +1,5 @@
 package brb
 
-import "fmt"
-
 // Simple 'brb' (NOT BRB) testing protocol
 type Flooding struct {
 	n   Network
@@ -18,10 +16,6 @@ func (f *Flooding) Init(n Network, app Application, cfg Config) {
 	f.app = app
 	f.cfg = cfg
 	f.seen = make(map[uint32]struct{})
-
-	if cfg.Byz {
-		fmt.Printf("process %v is a flooding Byzantine node\n", cfg.Id)
-	}
 }
 
 func (f *Flooding) flood(uid uint32, data Size, ex uint64) {
@@ -33,7 +27,8 @@ func (f *Flooding) flood(uid uint32, data Size, ex uint64) {
 }
 
 func (f *Flooding) Receive(_ uint8, src uint64, uid uint32, data Size) {
-	if f.cfg.Byz {
+	if !validPayload(data) {
+		f.n.TriggerStat(uid, MalformedMessage)
 		return
 	}
 
@@ -0,0 +1,46 @@
+package brb
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Messages are encoded using gob when they are written to disk, so all types that can be sent between processes
+// are registered
+func init() {
+	gob.Register(BrachaMessage{})
+	gob.Register(brachaWrapper{})
+	gob.Register(DolevMessage{})
+	gob.Register(DolevKnownMessage{})
+	gob.Register(DolevUnicastMessage{})
+	gob.Register(DolevKnownImprovedMessage{})
+	gob.Register(DolevWrapperMessage{})
+	gob.Register(BrachaDolevWrapperMsg{})
+	gob.Register(EquivocatedPayload{})
+	gob.Register(SignedEchoMessage{})
+	gob.Register(QuorumCertificate{})
+	gob.Register(AvidMessage{})
+	gob.Register(PayloadDigest{})
+}
+
+type gobBrachaWrapper struct {
+	MessageType uint8
+	Msg         Size
+}
+
+func (b brachaWrapper) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(gobBrachaWrapper{MessageType: b.messageType, Msg: b.msg})
+
+	return buf.Bytes(), err
+}
+
+func (b *brachaWrapper) GobDecode(data []byte) error {
+	var w gobBrachaWrapper
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&w); err != nil {
+		return err
+	}
+
+	b.messageType, b.msg = w.MessageType, w.Msg
+	return nil
+}
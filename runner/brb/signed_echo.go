@@ -0,0 +1,432 @@
+package brb
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"math"
+	"reflect"
+	"rp-runner/graphs"
+	"sort"
+)
+
+const (
+	SignedEchoSend  uint8 = 1
+	SignedEchoEcho  uint8 = 2
+	SignedEchoFinal uint8 = 3
+)
+
+// SignatureKeys contains the Ed25519 key of a process and the public keys of all processes
+type SignatureKeys struct {
+	Private ed25519.PrivateKey
+	Public  map[uint64]ed25519.PublicKey
+}
+
+// GenerateSignatureKeys generates a key pair for every process, all processes share the same public keys
+func GenerateSignatureKeys(ids []uint64) (map[uint64]SignatureKeys, error) {
+	public := make(map[uint64]ed25519.PublicKey, len(ids))
+	res := make(map[uint64]SignatureKeys, len(ids))
+
+	for _, id := range ids {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to generate signature key")
+		}
+
+		public[id] = pub
+		res[id] = SignatureKeys{Private: priv, Public: public}
+	}
+
+	return res, nil
+}
+
+// SignedEchoMessage is the signature of a process over the broadcast it echoes, it is only sent to the source
+type SignedEchoMessage struct {
+	Src       uint64
+	Id        uint32
+	Signature []byte
+}
+
+func (s SignedEchoMessage) SizeOf() uintptr {
+	return reflect.TypeOf(s.Src).Size() + reflect.TypeOf(s.Id).Size() + uintptr(len(s.Signature))
+}
+
+// QuorumCertificate contains the signatures of a quorum of processes that echoed a broadcast, which proves that no
+// other payload can be delivered for the same broadcast
+type QuorumCertificate struct {
+	Src        uint64
+	Id         uint32
+	Payload    Size
+	Signers    []uint64
+	Signatures [][]byte
+}
+
+func (q QuorumCertificate) SizeOf() uintptr {
+	r := reflect.TypeOf(q.Src).Size() + reflect.TypeOf(q.Id).Size() + q.Payload.SizeOf()
+	for i := range q.Signers {
+		r += reflect.TypeOf(q.Signers[i]).Size() + uintptr(len(q.Signatures[i]))
+	}
+
+	return r
+}
+
+type signedEchoIdentifier struct {
+	Src uint64
+	Id  uint32
+}
+
+// signedBroadcast is a broadcast of this process, for which the source collects signed echoes. The uid of the
+// broadcast is kept, as echoes can be replayed with a different uid.
+type signedBroadcast struct {
+	uid        uint32
+	payload    Size
+	hash       [sha256.Size]byte
+	signatures map[uint64][]byte
+	final      bool
+}
+
+// SignedEcho is signed echo broadcast: the source sends its payload to all, every process echoes it (once per
+// broadcast) by sending a signature back to the source. The source combines a quorum of signatures into a certificate,
+// which replaces the READY phase of Bracha. Processes deliver when they receive a valid certificate, and relay it
+// once so all correct processes deliver even if the source is Byzantine.
+type SignedEcho struct {
+	n   Network
+	app Application
+	cfg Config
+
+	cnt    uint32
+	bcId   int
+	quorum int
+
+	echoed     map[signedEchoIdentifier]struct{}
+	delivered  map[signedEchoIdentifier]struct{}
+	tracking   map[signedEchoIdentifier]uint32
+	broadcasts map[uint32]*signedBroadcast
+}
+
+var _ Protocol = (*SignedEcho)(nil)
+
+func (s *SignedEcho) Init(n Network, app Application, cfg Config) {
+	s.n = n
+	s.app = app
+	s.cfg = cfg
+	s.quorum = int(math.Ceil((float64(cfg.N) + float64(cfg.F) + 1) / 2))
+	s.echoed = make(map[signedEchoIdentifier]struct{})
+	s.delivered = make(map[signedEchoIdentifier]struct{})
+	s.tracking = make(map[signedEchoIdentifier]uint32)
+	s.broadcasts = make(map[uint32]*signedBroadcast)
+
+	if len(cfg.Signing.Private) != ed25519.PrivateKeySize {
+		panic("signed echo needs signature keys!")
+	}
+
+	_, layered := n.(*SignedEchoDolev)
+	if !layered && !cfg.Unused && cfg.Graph != nil && !graphs.IsFullyConnected(cfg.Graph) {
+		panic("signed echo does not work on non-fully connected networks!")
+	}
+}
+
+// signedStatement returns the bytes signed by processes echoing a broadcast
+func signedStatement(src uint64, id uint32, hash [sha256.Size]byte) []byte {
+	b := make([]byte, 12, 12+len(hash))
+	binary.BigEndian.PutUint64(b, src)
+	binary.BigEndian.PutUint32(b[8:], id)
+
+	return append(b, hash[:]...)
+}
+
+func (s *SignedEcho) verify(signer uint64, statement, signature []byte) bool {
+	key, ok := s.cfg.Signing.Public[signer]
+	return ok && len(key) == ed25519.PublicKeySize && ed25519.Verify(key, statement, signature)
+}
+
+// validCertificate returns whether a certificate contains valid signatures of a quorum of different processes
+func (s *SignedEcho) validCertificate(c QuorumCertificate) bool {
+	if len(c.Signers) != len(c.Signatures) || len(c.Signers) < s.quorum {
+		return false
+	}
+
+	statement := signedStatement(c.Src, c.Id, MustHash(c.Payload))
+	signed := make(map[uint64]struct{}, len(c.Signers))
+
+	for i, signer := range c.Signers {
+		if _, ok := signed[signer]; ok || !s.verify(signer, statement, c.Signatures[i]) {
+			return false
+		}
+		signed[signer] = struct{}{}
+	}
+
+	return true
+}
+
+func (s *SignedEcho) send(messageType uint8, uid uint32, data Size, to []uint64) {
+	i := s.bcId
+	s.bcId += 1
+
+	t := BrachaEveryone
+	if messageType == SignedEchoEcho {
+		t = BrachaDirect
+	}
+
+	for _, n := range to {
+		if n != s.cfg.Id {
+			s.n.Send(messageType, n, uid, data, BroadcastInfo{
+				Type: t,
+				Id:   i,
+			})
+		}
+	}
+}
+
+// track returns the uid of the first message received for a broadcast that is not delivered yet
+func (s *SignedEcho) track(id signedEchoIdentifier, uid uint32) uint32 {
+	if t, ok := s.tracking[id]; ok {
+		return t
+	}
+
+	s.tracking[id] = uid
+	return uid
+}
+
+// deliver delivers a certified broadcast and relays the certificate to all processes except from
+func (s *SignedEcho) deliver(uid uint32, c QuorumCertificate, from uint64) {
+	id := signedEchoIdentifier{Src: c.Src, Id: c.Id}
+	s.delivered[id] = struct{}{}
+	delete(s.tracking, id)
+	s.app.Deliver(uid, c.Payload, c.Src)
+
+	to := make([]uint64, 0, len(s.cfg.Neighbours))
+	for _, n := range s.cfg.Neighbours {
+		if n != from {
+			to = append(to, n)
+		}
+	}
+
+	s.send(SignedEchoFinal, uid, c, to)
+}
+
+// collect adds a signed echo for a broadcast of this process, once a quorum signed it is certified and delivered
+func (s *SignedEcho) collect(id uint32, signer uint64, signature []byte) {
+	b := s.broadcasts[id]
+	b.signatures[signer] = signature
+
+	if b.final || len(b.signatures) < s.quorum {
+		return
+	}
+	b.final = true
+
+	c := QuorumCertificate{Src: s.cfg.Id, Id: id, Payload: b.payload}
+	for signer := range b.signatures {
+		c.Signers = append(c.Signers, signer)
+	}
+	sort.Slice(c.Signers, func(i, j int) bool {
+		return c.Signers[i] < c.Signers[j]
+	})
+	for _, signer := range c.Signers {
+		c.Signatures = append(c.Signatures, b.signatures[signer])
+	}
+
+	s.deliver(b.uid, c, s.cfg.Id)
+	delete(s.broadcasts, id)
+}
+
+func (s *SignedEcho) Receive(messageType uint8, src uint64, uid uint32, data Size) {
+	switch messageType {
+	case SignedEchoSend:
+		// Only the source itself can send the initial message, links are authenticated so src can be trusted
+		m, ok := data.(BrachaMessage)
+		if !ok || m.Src != src || !validPayload(m.Payload) {
+			s.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		// A correct process signs only one payload for every broadcast, so at most one payload can be certified
+		id := signedEchoIdentifier{Src: m.Src, Id: m.Id}
+		if _, ok := s.delivered[id]; !ok {
+			s.track(id, uid)
+		}
+
+		if _, ok := s.echoed[id]; ok {
+			return
+		}
+		s.echoed[id] = struct{}{}
+
+		signature := ed25519.Sign(s.cfg.Signing.Private, signedStatement(m.Src, m.Id, MustHash(m.Payload)))
+		s.send(SignedEchoEcho, uid, SignedEchoMessage{Src: m.Src, Id: m.Id, Signature: signature}, []uint64{m.Src})
+	case SignedEchoEcho:
+		// Only the source collects echoes for its broadcasts
+		m, ok := data.(SignedEchoMessage)
+		if !ok || m.Src != s.cfg.Id {
+			if !ok {
+				s.n.TriggerStat(uid, MalformedMessage)
+			}
+			return
+		}
+
+		b, ok := s.broadcasts[m.Id]
+		if !ok {
+			return
+		}
+
+		if !s.verify(src, signedStatement(m.Src, m.Id, b.hash), m.Signature) {
+			s.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		s.collect(m.Id, src, m.Signature)
+	case SignedEchoFinal:
+		m, ok := data.(QuorumCertificate)
+		if !ok || !validPayload(m.Payload) {
+			s.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		id := signedEchoIdentifier{Src: m.Src, Id: m.Id}
+		if _, ok := s.delivered[id]; ok {
+			return
+		}
+
+		if !s.validCertificate(m) {
+			s.n.TriggerStat(uid, MalformedMessage)
+			return
+		}
+
+		s.deliver(s.track(id, uid), m, src)
+	default:
+		s.n.TriggerStat(uid, MalformedMessage)
+	}
+}
+
+func (s *SignedEcho) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
+	id := s.cnt
+	s.cnt += 1
+
+	m := BrachaMessage{
+		Src:     s.cfg.Id,
+		Id:      id,
+		Payload: payload,
+	}
+	hash := MustHash(payload)
+
+	s.echoed[signedEchoIdentifier{Src: s.cfg.Id, Id: id}] = struct{}{}
+	s.broadcasts[id] = &signedBroadcast{uid: uid, payload: payload, hash: hash, signatures: make(map[uint64][]byte)}
+
+	s.send(SignedEchoSend, uid, m, s.cfg.Neighbours)
+	s.collect(id, s.cfg.Id, ed25519.Sign(s.cfg.Signing.Private, signedStatement(s.cfg.Id, id, hash)))
+}
+
+func (s *SignedEcho) Category() ProtocolCategory {
+	return BrachaCat
+}
+
+// SignedEchoDolev layers SignedEcho over DolevKnownImproved, so it can be used on partially connected networks.
+// Echoes are sent to the source only, every other message of signed echo is broadcast using Dolev.
+type SignedEchoDolev struct {
+	signed  Protocol
+	dolev   Protocol
+	unicast dolevUnicast
+
+	n   Network
+	cfg Config
+
+	signedBroadcast map[int]struct{}
+}
+
+var _ Protocol = (*SignedEchoDolev)(nil)
+var _ Network = (*SignedEchoDolev)(nil)
+var _ Application = (*SignedEchoDolev)(nil)
+
+func (sd *SignedEchoDolev) Init(n Network, app Application, cfg Config) {
+	sd.n = n
+	sd.cfg = cfg
+	sd.signedBroadcast = make(map[int]struct{})
+
+	sil := cfg.Silent
+	cfg.Silent = true
+
+	// All processes are reachable through Dolev
+	sCfg := cfg
+	nids, _ := graphs.Nodes(cfg.Graph)
+	sCfg.Neighbours = make([]uint64, 0, len(nids))
+	for _, i := range nids {
+		if i != cfg.Id {
+			sCfg.Neighbours = append(sCfg.Neighbours, i)
+		}
+	}
+
+	if sd.signed == nil {
+		sd.signed = &SignedEcho{}
+	}
+	sd.signed.Init(sd, app, sCfg)
+
+	if sd.dolev == nil {
+		sd.dolev = &DolevKnownImproved{}
+	}
+	sd.dolev.Init(n, sd, cfg)
+	sd.unicast.Init(n, cfg)
+
+	cfg.Silent = sil
+}
+
+func (sd *SignedEchoDolev) Send(messageType uint8, dest uint64, uid uint32, data Size, bc BroadcastInfo) {
+	if bc.Type == BrachaDirect {
+		sd.unicast.Send(uid, dest, brachaWrapper{
+			messageType: messageType,
+			msg:         data,
+		})
+		return
+	}
+
+	// A message is broadcast only once to all
+	if _, ok := sd.signedBroadcast[bc.Id]; ok {
+		return
+	}
+	sd.signedBroadcast[bc.Id] = struct{}{}
+
+	sd.dolev.Broadcast(uid, brachaWrapper{
+		messageType: messageType,
+		msg:         data,
+	}, BroadcastInfo{})
+}
+
+func (sd *SignedEchoDolev) Deliver(uid uint32, payload Size, src uint64) {
+	// Dolev is delivering a message, so send it to signed echo
+	m, ok := payload.(brachaWrapper)
+	if !ok {
+		sd.n.TriggerStat(uid, MalformedMessage)
+		return
+	}
+
+	if src == sd.cfg.Id {
+		return
+	}
+
+	sd.signed.Receive(m.messageType, src, uid, m.msg)
+}
+
+func (sd *SignedEchoDolev) Receive(_ uint8, src uint64, uid uint32, data Size) {
+	if _, ok := data.(DolevUnicastMessage); ok {
+		if m, ok := sd.unicast.Receive(src, uid, data); ok {
+			sd.Deliver(uid, m.Payload, m.Src)
+		}
+		return
+	}
+
+	// Network is delivering a messages, pass to Dolev
+	sd.dolev.Receive(0, src, uid, data)
+}
+
+func (sd *SignedEchoDolev) Broadcast(uid uint32, payload Size, _ BroadcastInfo) {
+	// Application is requesting a broadcast, pass to signed echo
+	sd.signed.Broadcast(uid, payload, BroadcastInfo{})
+}
+
+func (sd *SignedEchoDolev) Category() ProtocolCategory {
+	return BrachaDolevCat
+}
+
+func (sd *SignedEchoDolev) TriggerStat(uid uint32, n NetworkStat) {
+	sd.n.TriggerStat(uid, n)
+}
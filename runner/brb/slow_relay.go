@@ -0,0 +1,156 @@
+package brb
+
+import (
+	"sync"
+	"time"
+)
+
+// SlowPhase determines until when the SlowRelayAdversary holds the messages of a broadcast
+type SlowPhase int
+
+const (
+	// Hold every message for the maximum delay
+	SlowUntilDelay SlowPhase = iota
+	// Hold the messages of a broadcast until the adversary has sent its own READY for it (Bracha only)
+	SlowUntilReady
+	// Hold the messages of a broadcast until the honest protocol of the adversary has delivered it
+	SlowUntilDeliver
+)
+
+// SlowRelayAdversary relays honestly, but holds every outgoing message for MaxDelay, or until the broadcast reaches
+// phase Until, whichever comes first. Messages are never dropped, so the adversary only affects latency.
+type SlowRelayAdversary struct {
+	interceptingAdversary
+	MaxDelay time.Duration
+	Until    SlowPhase
+
+	n       Network
+	reached map[uint32]struct{}
+	held    map[uint32][]*heldMessage
+	lock    sync.Mutex
+}
+
+type heldMessage struct {
+	messageType uint8
+	dest        uint64
+	uid         uint32
+	data        Size
+	bc          BroadcastInfo
+
+	sent bool
+}
+
+var _ Adversary = (*SlowRelayAdversary)(nil)
+var _ DelayingAdversary = (*SlowRelayAdversary)(nil)
+
+func (s *SlowRelayAdversary) SetMaxDelay(d time.Duration) {
+	s.MaxDelay = d
+}
+
+func (s *SlowRelayAdversary) Init(honest Protocol, n Network, app Application, cfg Config) {
+	s.n = n
+	s.reached = make(map[uint32]struct{})
+	s.held = make(map[uint32][]*heldMessage)
+
+	if s.Until == SlowUntilDeliver {
+		app = slowRelayApplication{Application: app, s: s}
+	}
+
+	s.honest = honest
+	s.cfg = cfg
+
+	// The broadcast info is kept, as held messages are sent later on
+	honest.Init(slowRelayNetwork{Network: n, s: s}, app, cfg)
+}
+
+func (s *SlowRelayAdversary) hold(messageType uint8, dest uint64, uid uint32, data Size, bc BroadcastInfo) {
+	if s.Until == SlowUntilReady && ownReady(s.cfg.Id, messageType, data) {
+		s.release(uid)
+	}
+
+	s.lock.Lock()
+	if _, ok := s.reached[uid]; ok {
+		s.lock.Unlock()
+		s.n.Send(messageType, dest, uid, data, bc)
+		return
+	}
+
+	m := &heldMessage{messageType: messageType, dest: dest, uid: uid, data: data, bc: bc}
+	s.held[uid] = append(s.held[uid], m)
+	s.lock.Unlock()
+
+	after(s.n, dest, s.MaxDelay, func() {
+		s.lock.Lock()
+		send := !m.sent
+		m.sent = true
+		s.lock.Unlock()
+
+		if send {
+			s.n.Send(m.messageType, m.dest, m.uid, m.data, m.bc)
+		}
+	})
+}
+
+// release sends all messages held for broadcast uid, later messages for uid are no longer held
+func (s *SlowRelayAdversary) release(uid uint32) {
+	s.lock.Lock()
+	s.reached[uid] = struct{}{}
+
+	held := s.held[uid]
+	delete(s.held, uid)
+
+	send := make([]*heldMessage, 0, len(held))
+	for _, m := range held {
+		if !m.sent {
+			m.sent = true
+			send = append(send, m)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, m := range send {
+		s.n.Send(m.messageType, m.dest, m.uid, m.data, m.bc)
+	}
+}
+
+// slowRelayNetwork hands all messages of the honest protocol to the adversary, keeping the broadcast info
+type slowRelayNetwork struct {
+	Network
+	s *SlowRelayAdversary
+}
+
+func (n slowRelayNetwork) Send(messageType uint8, dest uint64, uid uint32, data Size, bc BroadcastInfo) {
+	n.s.hold(messageType, dest, uid, data, bc)
+}
+
+// slowRelayApplication releases the messages of a broadcast once the honest protocol delivers it
+type slowRelayApplication struct {
+	Application
+	s *SlowRelayAdversary
+}
+
+func (a slowRelayApplication) Deliver(uid uint32, payload Size, src uint64) {
+	a.s.release(uid)
+	a.Application.Deliver(uid, payload, src)
+}
+
+// ownReady returns whether a message contains the READY message of Bracha process id
+func ownReady(id uint64, messageType uint8, data Size) bool {
+	switch m := data.(type) {
+	case BrachaMessage:
+		return messageType == BrachaReady
+	case DolevKnownImprovedMessage:
+		switch p := m.Payload.(type) {
+		case brachaWrapper:
+			return m.Src == id && p.messageType == BrachaReady
+		case BrachaDolevWrapperMsg:
+			for _, bm := range p.Msgs {
+				if bm.Src == id && bm.Type == BrachaReady {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
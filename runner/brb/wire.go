@@ -0,0 +1,558 @@
+package brb
+
+import (
+	"encoding"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/graph/simple"
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+)
+
+// WireVersion is the version of the binary encoding of protocol messages, it is the first byte of every encoded message
+const WireVersion uint8 = 1
+
+// Every encoded value starts with the tag of its type. Application payloads are encoded using their MarshalBinary
+// method and decoded using the function passed to RegisterPayload.
+const (
+	wirePayload uint8 = iota
+	wireBracha
+	wireBrachaWrapper
+	wireDolevKnownImproved
+	wireBrachaDolevWrapper
+	wireDolevWrapper
+	wireEquivocated
+	wireDolev
+	wireDolevKnown
+	wireSignedEcho
+	wireCertificate
+	wireAvid
+	wireDigest
+	wireDolevUnicast
+)
+
+// Paths are encoded as the nodes they visit when all edges are connected, otherwise as pairs of nodes. The weights of
+// edges are not encoded, protocols only compare edges by their nodes.
+const (
+	pathEdges uint8 = iota
+	pathNodes
+)
+
+var decodePayload func([]byte) (Size, error)
+
+// RegisterPayload sets the function used to decode application payloads, payloads are required to implement
+// encoding.BinaryMarshaler to be encoded
+func RegisterPayload(decode func([]byte) (Size, error)) {
+	decodePayload = decode
+}
+
+// Encode encodes a protocol message using the binary wire format
+func Encode(m Size) ([]byte, error) {
+	return appendValue([]byte{WireVersion}, m)
+}
+
+// Decode decodes a protocol message encoded by Encode, it never panics on malformed input
+func Decode(b []byte) (Size, error) {
+	if len(b) == 0 || b[0] != WireVersion {
+		return nil, errors.New("unsupported wire version")
+	}
+
+	r := &wireReader{b: b[1:]}
+	res := r.value()
+	if r.err == nil && len(r.b) > 0 {
+		r.err = errors.New("trailing bytes after message")
+	}
+
+	return res, r.err
+}
+
+// WireSize returns the size of the encoded message, messages that can not be encoded fall back to their estimated size
+func WireSize(m Size) uintptr {
+	b, err := Encode(m)
+	if err != nil {
+		return m.SizeOf()
+	}
+
+	return uintptr(len(b))
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+
+	return append(b, buf[:n]...)
+}
+
+func appendId(b []byte, id uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], id)
+
+	return append(b, buf[:]...)
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+
+	return append(b, 0)
+}
+
+func appendPath(b []byte, p graphs.Path) ([]byte, error) {
+	if !validEdges(p) {
+		return nil, errors.New("unable to encode incomplete edge")
+	}
+
+	b = appendUvarint(b, uint64(len(p)))
+	if len(p) == 0 {
+		return b, nil
+	}
+
+	connected := true
+	for i := 1; i < len(p); i++ {
+		if p[i].From().ID() != p[i-1].To().ID() {
+			connected = false
+			break
+		}
+	}
+
+	if connected {
+		b = append(b, pathNodes)
+		b = appendUvarint(b, uint64(p[0].From().ID()))
+		for _, e := range p {
+			b = appendUvarint(b, uint64(e.To().ID()))
+		}
+
+		return b, nil
+	}
+
+	b = append(b, pathEdges)
+	for _, e := range p {
+		b = appendUvarint(b, uint64(e.From().ID()))
+		b = appendUvarint(b, uint64(e.To().ID()))
+	}
+
+	return b, nil
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	b = appendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendDolevPath(b []byte, p algo.DolevPath) ([]byte, error) {
+	b = appendBool(b, p.Prio)
+	b, err := appendPath(b, p.Desired)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendPath(b, p.Actual)
+}
+
+func appendDolevPaths(b []byte, paths []algo.DolevPath) ([]byte, error) {
+	var err error
+
+	b = appendUvarint(b, uint64(len(paths)))
+	for _, p := range paths {
+		if b, err = appendDolevPath(b, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func appendValue(b []byte, v Size) ([]byte, error) {
+	var err error
+
+	switch m := v.(type) {
+	case BrachaMessage:
+		b = append(b, wireBracha)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		return appendValue(b, m.Payload)
+	case brachaWrapper:
+		b = append(b, wireBrachaWrapper, m.messageType)
+		return appendValue(b, m.msg)
+	case DolevKnownImprovedMessage:
+		b = append(b, wireDolevKnownImproved)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		b = appendBool(b, m.Partial)
+		if b, err = appendDolevPaths(b, m.Paths); err != nil {
+			return nil, err
+		}
+
+		return appendValue(b, m.Payload)
+	case BrachaDolevWrapperMsg:
+		b = append(b, wireBrachaDolevWrapper)
+		b = appendUvarint(b, m.OriginalSrc)
+		b = appendId(b, m.OriginalId)
+		if b, err = appendValue(b, m.OriginalPayload); err != nil {
+			return nil, err
+		}
+
+		b = appendUvarint(b, uint64(len(m.Msgs)))
+		for _, bm := range m.Msgs {
+			b = appendUvarint(b, bm.Src)
+			b = appendId(b, bm.Id)
+			b = append(b, bm.Type)
+			b = appendBool(b, bm.Partial)
+			if b, err = appendDolevPaths(b, bm.Paths); err != nil {
+				return nil, err
+			}
+		}
+
+		return b, nil
+	case DolevWrapperMessage:
+		b = append(b, wireDolevWrapper)
+		if b, err = appendValue(b, m.Payload); err != nil {
+			return nil, err
+		}
+
+		b = appendUvarint(b, uint64(len(m.Msgs)))
+		for _, dm := range m.Msgs {
+			b = appendUvarint(b, dm.Src)
+			b = appendId(b, dm.Id)
+			b = appendId(b, dm.TrackingId)
+			if b, err = appendDolevPaths(b, dm.Paths); err != nil {
+				return nil, err
+			}
+		}
+
+		return b, nil
+	case EquivocatedPayload:
+		b = append(b, wireEquivocated)
+		b = appendUvarint(b, m.Variant)
+		b = appendBool(b, m.Original != nil)
+		if m.Original == nil {
+			return b, nil
+		}
+
+		return appendValue(b, m.Original)
+	case DolevMessage:
+		b = append(b, wireDolev)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		if b, err = appendPath(b, m.Path); err != nil {
+			return nil, err
+		}
+
+		return appendValue(b, m.Payload)
+	case DolevKnownMessage:
+		b = append(b, wireDolevKnown)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		if b, err = appendDolevPath(b, m.Path); err != nil {
+			return nil, err
+		}
+
+		return appendValue(b, m.Payload)
+	case DolevUnicastMessage:
+		b = append(b, wireDolevUnicast)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		if b, err = appendDolevPath(b, m.Path); err != nil {
+			return nil, err
+		}
+
+		return appendValue(b, m.Payload)
+	case SignedEchoMessage:
+		b = append(b, wireSignedEcho)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		return appendBytes(b, m.Signature), nil
+	case QuorumCertificate:
+		if len(m.Signers) != len(m.Signatures) {
+			return nil, errors.New("unable to encode certificate with missing signatures")
+		}
+
+		b = append(b, wireCertificate)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		b = appendUvarint(b, uint64(len(m.Signers)))
+		for i, signer := range m.Signers {
+			b = appendUvarint(b, signer)
+			b = appendBytes(b, m.Signatures[i])
+		}
+
+		return appendValue(b, m.Payload)
+	case AvidMessage:
+		b = append(b, wireAvid)
+		b = appendUvarint(b, m.Src)
+		b = appendId(b, m.Id)
+		b = appendBytes(b, m.Root)
+		b = appendBytes(b, m.Fragment)
+		b = appendUvarint(b, uint64(len(m.Proof)))
+		for _, p := range m.Proof {
+			b = appendBytes(b, p)
+		}
+
+		return b, nil
+	case PayloadDigest:
+		b = append(b, wireDigest)
+		b = appendBytes(b, m.Hash[:])
+		b = appendUvarint(b, uint64(len(m.Holders)))
+		for _, h := range m.Holders {
+			b = appendUvarint(b, h)
+		}
+
+		return b, nil
+	case encoding.BinaryMarshaler:
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to encode payload")
+		}
+
+		b = append(b, wirePayload)
+		return appendBytes(b, data), nil
+	default:
+		return nil, errors.Errorf("unable to encode message of type %T", v)
+	}
+}
+
+// wireReader decodes values from an encoded message, after the first error all values are empty
+type wireReader struct {
+	b   []byte
+	err error
+}
+
+func (r *wireReader) fail(msg string) {
+	if r.err == nil {
+		r.err = errors.New(msg)
+	}
+	r.b = nil
+}
+
+func (r *wireReader) byte() uint8 {
+	if len(r.b) < 1 {
+		r.fail("message too short")
+		return 0
+	}
+
+	res := r.b[0]
+	r.b = r.b[1:]
+	return res
+}
+
+func (r *wireReader) bool() bool {
+	switch r.byte() {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		r.fail("invalid boolean")
+		return false
+	}
+}
+
+func (r *wireReader) id() uint32 {
+	if len(r.b) < 4 {
+		r.fail("message too short")
+		return 0
+	}
+
+	res := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return res
+}
+
+func (r *wireReader) uvarint() uint64 {
+	res, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+
+	r.b = r.b[n:]
+	return res
+}
+
+// count reads the length of a list, every element takes at least min bytes so longer lists can not be valid
+func (r *wireReader) count(min int) int {
+	n := r.uvarint()
+	if n > uint64(len(r.b)/min) {
+		r.fail("list longer than message")
+		return 0
+	}
+
+	return int(n)
+}
+
+func (r *wireReader) bytes() []byte {
+	n := r.count(1)
+	res := r.b[:n]
+	r.b = r.b[n:]
+
+	return res
+}
+
+func (r *wireReader) path() graphs.Path {
+	n := r.count(1)
+	if n == 0 {
+		return nil
+	}
+
+	edge := func(from, to uint64) simple.WeightedEdge {
+		return simple.WeightedEdge{F: simple.Node(int64(from)), T: simple.Node(int64(to)), W: 1}
+	}
+
+	res := make(graphs.Path, 0, n)
+	switch r.byte() {
+	case pathNodes:
+		prev := r.uvarint()
+		for i := 0; i < n && r.err == nil; i++ {
+			next := r.uvarint()
+			res = append(res, edge(prev, next))
+			prev = next
+		}
+	case pathEdges:
+		for i := 0; i < n && r.err == nil; i++ {
+			from := r.uvarint()
+			res = append(res, edge(from, r.uvarint()))
+		}
+	default:
+		r.fail("invalid path encoding")
+	}
+
+	return res
+}
+
+func (r *wireReader) dolevPath() algo.DolevPath {
+	prio := r.bool()
+	return algo.DolevPath{Prio: prio, Desired: r.path(), Actual: r.path()}
+}
+
+func (r *wireReader) dolevPaths() []algo.DolevPath {
+	n := r.count(3)
+	if n == 0 {
+		return nil
+	}
+
+	res := make([]algo.DolevPath, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		res = append(res, r.dolevPath())
+	}
+
+	return res
+}
+
+func (r *wireReader) value() Size {
+	switch r.byte() {
+	case wireBracha:
+		m := BrachaMessage{Src: r.uvarint(), Id: r.id()}
+		m.Payload = r.value()
+		return m
+	case wireBrachaWrapper:
+		m := brachaWrapper{messageType: r.byte()}
+		m.msg = r.value()
+		return m
+	case wireDolevKnownImproved:
+		m := DolevKnownImprovedMessage{Src: r.uvarint(), Id: r.id(), Partial: r.bool()}
+		m.Paths = r.dolevPaths()
+		m.Payload = r.value()
+		return m
+	case wireBrachaDolevWrapper:
+		m := BrachaDolevWrapperMsg{OriginalSrc: r.uvarint(), OriginalId: r.id()}
+		m.OriginalPayload = r.value()
+
+		n := r.count(8)
+		m.Msgs = make([]BrachaDolevMessage, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			bm := BrachaDolevMessage{Src: r.uvarint(), Id: r.id(), Type: r.byte(), Partial: r.bool()}
+			bm.Paths = r.dolevPaths()
+			m.Msgs = append(m.Msgs, bm)
+		}
+
+		return m
+	case wireDolevWrapper:
+		m := DolevWrapperMessage{Payload: r.value()}
+
+		n := r.count(10)
+		m.Msgs = make([]dolevWrapperWrapper, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			dm := dolevWrapperWrapper{Src: r.uvarint(), Id: r.id(), TrackingId: r.id()}
+			dm.Paths = r.dolevPaths()
+			m.Msgs = append(m.Msgs, dm)
+		}
+
+		return m
+	case wireEquivocated:
+		m := EquivocatedPayload{Variant: r.uvarint()}
+		if r.bool() {
+			m.Original = r.value()
+		}
+		return m
+	case wireDolev:
+		m := DolevMessage{Src: r.uvarint(), Id: r.id(), Path: r.path()}
+		m.Payload = r.value()
+		return m
+	case wireDolevKnown:
+		m := DolevKnownMessage{Src: r.uvarint(), Id: r.id(), Path: r.dolevPath()}
+		m.Payload = r.value()
+		return m
+	case wireDolevUnicast:
+		m := DolevUnicastMessage{Src: r.uvarint(), Id: r.id(), Path: r.dolevPath()}
+		m.Payload = r.value()
+		return m
+	case wireSignedEcho:
+		return SignedEchoMessage{Src: r.uvarint(), Id: r.id(), Signature: r.bytes()}
+	case wireCertificate:
+		m := QuorumCertificate{Src: r.uvarint(), Id: r.id()}
+
+		n := r.count(2)
+		m.Signers = make([]uint64, 0, n)
+		m.Signatures = make([][]byte, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			m.Signers = append(m.Signers, r.uvarint())
+			m.Signatures = append(m.Signatures, r.bytes())
+		}
+
+		m.Payload = r.value()
+		return m
+	case wireAvid:
+		m := AvidMessage{Src: r.uvarint(), Id: r.id(), Root: r.bytes(), Fragment: r.bytes()}
+
+		n := r.count(1)
+		m.Proof = make([][]byte, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			m.Proof = append(m.Proof, r.bytes())
+		}
+
+		return m
+	case wireDigest:
+		var m PayloadDigest
+		if h := r.bytes(); len(h) == len(m.Hash) {
+			copy(m.Hash[:], h)
+		} else {
+			r.fail("invalid digest size")
+		}
+
+		n := r.count(1)
+		for i := 0; i < n && r.err == nil; i++ {
+			m.Holders = append(m.Holders, r.uvarint())
+		}
+
+		return m
+	case wirePayload:
+		data := r.bytes()
+
+		if r.err != nil {
+			return nil
+		} else if decodePayload == nil {
+			r.fail("no payload decoder registered")
+			return nil
+		}
+
+		p, err := decodePayload(data)
+		if err != nil {
+			r.fail(err.Error())
+		}
+		return p
+	default:
+		r.fail("unknown message type")
+		return nil
+	}
+}
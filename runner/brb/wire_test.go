@@ -0,0 +1,74 @@
+package brb
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func (f fuzzPayload) MarshalBinary() ([]byte, error) {
+	return []byte(f), nil
+}
+
+func init() {
+	RegisterPayload(func(b []byte) (Size, error) {
+		return fuzzPayload(b), nil
+	})
+}
+
+// wireMessages returns random messages that can be encoded, messages with nil payloads or edges can not
+func wireMessages(n int) [][]byte {
+	r := rand.New(rand.NewSource(1))
+
+	var res [][]byte
+	for len(res) < n {
+		if b, err := Encode(fuzzSize(r, 3)); err == nil {
+			res = append(res, b)
+		}
+	}
+
+	return res
+}
+
+func TestWireRoundTrip(t *testing.T) {
+	for _, b := range wireMessages(500) {
+		m, err := Decode(b)
+		if err != nil {
+			t.Fatalf("unable to decode %x: %v", b, err)
+		}
+
+		res, err := Encode(m)
+		if err != nil {
+			t.Fatalf("unable to encode decoded %+v: %v", m, err)
+		}
+
+		if !bytes.Equal(b, res) {
+			t.Fatalf("decoded %+v is encoded as %x instead of %x", m, res, b)
+		}
+	}
+}
+
+func TestWireMalformed(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+
+	for _, b := range wireMessages(200) {
+		for i := 0; i < len(b); i++ {
+			if _, err := Decode(b[:i]); err == nil {
+				t.Fatalf("decoded truncated message %x", b[:i])
+			}
+		}
+
+		c := append([]byte(nil), b...)
+		for i := 0; i < 5; i++ {
+			c[r.Intn(len(c))] = byte(r.Intn(256))
+			_, _ = Decode(c)
+		}
+	}
+}
+
+func TestWireSize(t *testing.T) {
+	m := DolevKnownImprovedMessage{Src: 3, Id: 7, Payload: fuzzPayload("payload")}
+	if size := WireSize(m); size != 1+1+1+4+1+1+1+1+7 {
+		t.Fatalf("expected message without paths to take 18 bytes, got %v", size)
+	}
+}
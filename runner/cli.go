@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"github.com/fatih/color"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
 	"log"
+	"math/rand"
 	"os"
 	"rp-runner/brb"
 	"rp-runner/ctrl"
@@ -52,21 +54,25 @@ func CLI() {
 						Value: &EnumValue{
 							Enum: []string{"brachaDolevIndividualTests", "brachaDolevFullTests",
 								"brachaDolevScaleTests", "dolevIndividualTests", "dolevFullTests",
-								"dolevScaleTests", "brachaIndividualTests", "brachaFullTests", "brachaScaleTests"},
+								"dolevScaleTests", "brachaIndividualTests", "brachaFullTests", "brachaScaleTests",
+								"payloadSweepTests"},
 							Default: "",
 						},
 						Usage: "select the template to use: brachaDolevIndividualTests | brachaDolevFullTests |" +
 							" brachaDolevScaleTests | dolevIndividualTests | dolevFullTests | dolevScaleTests |" +
-							" brachaIndividualTests | brachaFullTests | brachaScaleTests",
+							" brachaIndividualTests | brachaFullTests | brachaScaleTests | payloadSweepTests",
 					},
 					&cli.GenericFlag{
 						Name:    "protocol",
 						Aliases: []string{"p"},
 						Value: &EnumValue{
-							Enum:    []string{"dolev", "bracha", "brachaDolev"},
+							Enum: []string{"dolev", "dolevUnknown", "bracha", "brachaDolev", "signedEcho",
+								"signedEchoDolev", "avid"},
 							Default: "dolev",
 						},
-						Usage: "select the template to use: dolev | bracha | brachaDolev (default: dolev)",
+						Usage: "select the template to use: dolev | dolevUnknown (dolev for unknown topologies) | bracha |" +
+							" brachaDolev | signedEcho (bracha with signed echoes) | signedEchoDolev | avid (erasure coded" +
+							" bracha) (default: dolev)",
 					},
 					&cli.GenericFlag{
 						Name:    "generator",
@@ -78,6 +84,190 @@ func CLI() {
 						Usage: "select the template to use: randomRegular | multiPartite |" +
 							" fullyConnected | generalizedWheel (default: randomRegular)",
 					},
+					&cli.GenericFlag{
+						Name:    "adversary",
+						Aliases: []string{"adv"},
+						Value: &EnumValue{
+							Enum:    brb.AdversaryNames(),
+							Default: "silent",
+						},
+						Usage: "select the behaviour of Byzantine nodes: " + strings.Join(brb.AdversaryNames(), " | ") +
+							" (default: silent)",
+					},
+					&cli.DurationFlag{
+						Name:  "adv-delay",
+						Usage: "maximum time adversaries that hold messages (slowRelay*) hold each message",
+						Value: time.Second,
+					},
+					&cli.BoolFlag{
+						Name:  "byz-source",
+						Usage: "make the source of every broadcast byzantine (uses the selected adversary)",
+					},
+					&cli.DurationFlag{
+						Name:  "deliver-timeout",
+						Usage: "time to wait for deliveries of broadcasts from a byzantine source",
+						Value: time.Second * 5,
+					},
+					&cli.GenericFlag{
+						Name: "placement",
+						Value: &EnumValue{
+							Enum:    ctrl.PlacementNames(),
+							Default: "first",
+						},
+						Usage: "select the placement of Byzantine nodes: " + strings.Join(ctrl.PlacementNames(), " | ") +
+							" (default: first)",
+					},
+					&cli.Int64Flag{
+						Name:  "placement-seed",
+						Usage: "seed used by the random placement (0 uses --seed)",
+					},
+					&cli.Int64SliceFlag{
+						Name:  "byz-nodes",
+						Usage: "ids of the byzantine nodes used by the explicit placement",
+					},
+					&cli.IntFlag{
+						Name:  "adaptive",
+						Usage: "amount of byzantine nodes that are corrupted adaptively (one every run) instead of placed",
+						Value: 0,
+					},
+					&cli.DurationFlag{
+						Name:  "adaptive-delay",
+						Usage: "corrupt adaptively this long after the broadcasts of a run are sent (0 corrupts between runs)",
+						Value: 0,
+					},
+					&cli.GenericFlag{
+						Name: "adaptive-target",
+						Value: &EnumValue{
+							Enum:    ctrl.TargetNames(),
+							Default: "active",
+						},
+						Usage: "select the processes to corrupt adaptively: active (most messages sent) | paths (on most" +
+							" routing table paths) | subset (in the bracha minimal subset)",
+					},
+					&cli.BoolFlag{
+						Name:  "simulate",
+						Usage: "use a discrete-event simulation with a virtual clock instead of running all processes concurrently",
+					},
+					&cli.DurationFlag{
+						Name:  "latency",
+						Usage: "latency of every link when simulating",
+						Value: time.Millisecond,
+					},
+					&cli.Float64Flag{
+						Name:  "bandwidth",
+						Usage: "bandwidth (bytes/s) of every link when simulating (0 is unlimited)",
+						Value: 0,
+					},
+					&cli.Float64Flag{
+						Name:  "link-spread",
+						Usage: "randomly vary the latency and bandwidth of every link by at most this fraction (0 - 1)",
+						Value: 0,
+					},
+					&cli.StringFlag{
+						Name:  "link-profile",
+						Usage: "file with the properties of specific edges of the graph (lines of: from to latency [bandwidth [drop [duplicate [reorder]]]])",
+					},
+					&cli.Float64Flag{
+						Name:  "drop",
+						Usage: "probability that a link loses a message",
+						Value: 0,
+					},
+					&cli.Float64Flag{
+						Name:  "duplicate",
+						Usage: "probability that a link duplicates a message",
+						Value: 0,
+					},
+					&cli.Float64Flag{
+						Name:  "reorder",
+						Usage: "probability that a link delays a message (up to 10ms), reordering it",
+						Value: 0,
+					},
+					&cli.BoolFlag{
+						Name:  "reliable",
+						Usage: "retransmit messages until they are acknowledged, to make lossy links reliable",
+					},
+					&cli.DurationFlag{
+						Name:  "retransmit",
+						Usage: "time after which an unacknowledged message is retransmitted",
+						Value: time.Millisecond * 50,
+					},
+					&cli.BoolFlag{
+						Name:  "authenticate",
+						Usage: "authenticate links using pairwise keys (HMAC), so byzantine nodes can not impersonate others",
+					},
+					&cli.StringFlag{
+						Name: "partitions",
+						Usage: "cut links between processes during every run, as partitions separated by ; (e.g. " +
+							"200ms-1s:0,1,2 cuts 0, 1 and 2 off from the rest, 200ms-1s:0,1/2,3 only from 2 and 3)",
+					},
+					&cli.GenericFlag{
+						Name: "partition-policy",
+						Value: &EnumValue{
+							Enum:    []string{"queue", "drop"},
+							Default: "queue",
+						},
+						Usage: "what happens to messages sent over a cut link: queue (sent when healed) | drop (default: queue)",
+					},
+					&cli.Int64Flag{
+						Name:  "seed",
+						Usage: "seed of all randomness, such as the graph, transmitters, placement and links, simulated runs with the same seed have the same results (random when not set)",
+					},
+					&cli.GenericFlag{
+						Name: "schedule",
+						Value: &EnumValue{
+							Enum:    []string{"none", "random", "starve", "lifo", "reversePath"},
+							Default: "none",
+						},
+						Usage: "simulate handling in-flight messages in an adversarial order: none | random | starve |" +
+							" lifo | reversePath (default: none)",
+					},
+					&cli.Int64Flag{
+						Name:  "sched-seed",
+						Usage: "seed of the schedule of the first run, every next run uses the next seed (--seed when not set)",
+					},
+					&cli.Float64Flag{
+						Name:  "sched-bias",
+						Usage: "probability that the message preferred by the schedule is handled instead of a random one",
+						Value: 0.9,
+					},
+					&cli.Uint64Flag{
+						Name:  "starve",
+						Usage: "process starved by the starve schedule",
+						Value: 0,
+					},
+					&cli.IntFlag{
+						Name:  "queue-size",
+						Usage: "amount of messages queued for every link before the overflow policy is used (0 is unbounded)",
+						Value: 0,
+					},
+					&cli.GenericFlag{
+						Name: "overflow",
+						Value: &EnumValue{
+							Enum:    []string{"block", "dropOldest", "spill"},
+							Default: "block",
+						},
+						Usage: "what happens to messages that do not fit in the queue of a link: block | dropOldest |" +
+							" spill (to disk), block can deadlock neighbours with full queues to each other (default: block)",
+					},
+					&cli.StringFlag{
+						Name:  "spill-dir",
+						Usage: "directory of the files with spilled messages (default: temporary directory)",
+					},
+					&cli.GenericFlag{
+						Name: "transport",
+						Value: &EnumValue{
+							Enum:    []string{"channel", "tcp"},
+							Default: "channel",
+						},
+						Usage: "how processes are connected: channel (all processes in this OS process) | tcp (every" +
+							" process in its own OS process, connected over localhost) (default: channel)",
+					},
+					&cli.StringFlag{
+						Name: "address-book",
+						Usage: "file with the addresses of the controller and processes connected over tcp (lines of:" +
+							" id host:port, where id is a process or controller), processes on other hosts are started" +
+							" using the process command",
+					},
 					&cli.IntFlag{
 						Name:  "skip",
 						Usage: "set the amount of template tests to skip",
@@ -131,7 +321,7 @@ func CLI() {
 					},
 					&cli.BoolFlag{
 						Name:  "cache",
-						Usage: "use graph cache",
+						Usage: "use graph cache, random graphs are stored for every seed so use --seed to reuse them",
 					},
 
 					&cli.BoolFlag{
@@ -171,6 +361,10 @@ func CLI() {
 						Name:  "orb2",
 						Usage: "enable orb2 (minimal subset)",
 					},
+					&cli.BoolFlag{
+						Name:  "orb3",
+						Usage: "enable orb3 (digests in echo and ready, payloads are requested when needed)",
+					},
 
 					&cli.BoolFlag{
 						Name:  "orbd1",
@@ -205,6 +399,42 @@ func CLI() {
 					}
 				},
 			},
+			{
+				Name:  "process",
+				Usage: "Run a single process connected over tcp, which serves a single test of the controller (or all with --serve)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "book",
+						Usage: "address book of the test, the process joins the controller of the address book",
+					},
+					&cli.Uint64Flag{
+						Name:  "id",
+						Usage: "id of the process in the address book",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "how long to keep trying to reach the controller",
+						Value: time.Minute,
+					},
+					&cli.BoolFlag{
+						Name:  "serve",
+						Usage: "keep joining the controller for every next test, until it can not be reached within the timeout",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					// Without an address book the process was started by the controller, which uses pipes
+					if !c.IsSet("book") {
+						return ctrl.RunRemoteProcess(os.NewFile(3, "controller-in"), os.NewFile(4, "controller-out"))
+					}
+
+					book, err := ctrl.ReadAddressBook(c.String("book"))
+					if err != nil {
+						return err
+					}
+
+					return ctrl.RunBookProcess(book, c.Uint64("id"), c.Duration("timeout"), c.Bool("serve"))
+				},
+			},
 		},
 	}
 
@@ -214,17 +444,175 @@ func CLI() {
 	}
 }
 
+// globalSeed returns the seed of all randomness, which is picked randomly when not set
+func globalSeed(c *cli.Context) int64 {
+	if c.IsSet("seed") {
+		return c.Int64("seed")
+	}
+
+	return rand.Int63()
+}
+
+// linkModel creates the links between processes
+func linkModel(c *cli.Context, seed int64) (process.LinkModel, error) {
+	base := process.Link{
+		Latency:   c.Duration("latency"),
+		Bandwidth: c.Float64("bandwidth"),
+		Drop:      c.Float64("drop"),
+		Duplicate: c.Float64("duplicate"),
+		Reorder:   c.Float64("reorder"),
+	}
+
+	if err := base.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Latency and bandwidth only exist in virtual time, real processes only lose, duplicate and reorder messages
+	simulated := c.Bool("simulate") || c.Generic("schedule").(*EnumValue).String() != "none"
+	if !simulated && (c.IsSet("latency") || c.IsSet("bandwidth") || c.IsSet("link-spread")) {
+		return nil, errors.New("link latency and bandwidth are only used when simulating (--simulate)")
+	}
+
+	var links process.LinkModel = process.UniformLinks(base)
+	if spread := c.Float64("link-spread"); spread < 0 || spread > 1 {
+		return nil, errors.Errorf("link spread must be between 0 and 1, got %v", spread)
+	} else if spread > 0 {
+		links = process.SpreadLinks{Base: base, Spread: spread, Seed: seed}
+	}
+
+	if name := c.String("link-profile"); name != "" {
+		if !simulated {
+			fmt.Println("warning: not simulating, only the drop, duplicate and reorder probabilities of the link profile are used")
+		}
+
+		return process.ReadLinkProfile(name, links)
+	}
+
+	return links, nil
+}
+
+// scheduler creates the adversarial scheduler, which is nil when messages are handled in order
+func scheduler(c *cli.Context, seed int64) *process.Scheduler {
+	biases := map[string]process.ScheduleBias{
+		"random":      process.RandomSchedule,
+		"starve":      process.StarveSchedule,
+		"lifo":        process.LIFOSchedule,
+		"reversePath": process.ReversePathSchedule,
+	}
+
+	bias, ok := biases[c.Generic("schedule").(*EnumValue).String()]
+	if !ok {
+		return nil
+	}
+
+	if c.IsSet("sched-seed") {
+		seed = c.Int64("sched-seed")
+	}
+
+	return process.NewScheduler(bias, c.Float64("sched-bias"), c.Uint64("starve"), seed)
+}
+
+// addressBook reads the address book, which is nil when not set
+func addressBook(c *cli.Context) (*ctrl.AddressBook, error) {
+	if !c.IsSet("address-book") {
+		return nil, nil
+	}
+
+	return ctrl.ReadAddressBook(c.String("address-book"))
+}
+
+func transport(c *cli.Context) ctrl.Transport {
+	if c.Generic("transport").(*EnumValue).String() == "tcp" {
+		return ctrl.TCPTransport
+	}
+
+	return ctrl.ChannelTransport
+}
+
+func overflowPolicy(c *cli.Context) process.OverflowPolicy {
+	switch c.Generic("overflow").(*EnumValue).String() {
+	case "dropOldest":
+		return process.DropOldestOverflow
+	case "spill":
+		return process.SpillOverflow
+	default:
+		return process.BlockOverflow
+	}
+}
+
+// partitions parses the partition schedule, which is nil when there are no partitions
+func partitions(c *cli.Context) (*process.Partitions, error) {
+	s := strings.TrimSpace(c.String("partitions"))
+	if s == "" {
+		return nil, nil
+	}
+
+	res := &process.Partitions{Policy: process.QueuePartitioned}
+	if c.Generic("partition-policy").(*EnumValue).String() == "drop" {
+		res.Policy = process.DropPartitioned
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		p, err := process.ParsePartition(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		res.Schedule = append(res.Schedule, p)
+	}
+
+	return res, nil
+}
+
 func runTemplate(c *cli.Context) error {
+	seed := globalSeed(c)
+	links, err := linkModel(c, seed)
+	if err != nil {
+		return err
+	}
+
+	parts, err := partitions(c)
+	if err != nil {
+		return err
+	}
+
+	book, err := addressBook(c)
+	if err != nil {
+		return err
+	}
+
 	info := ctrl.Config{
-		PollDelay:  time.Millisecond * 200,
-		CtrlBuffer: 2000,
-		ProcBuffer: 50000,
-		Verbosity:  ctrl.Verbosity(c.Int("verbosity")),
+		PollDelay:           time.Millisecond * 200,
+		CtrlBuffer:          2000,
+		ProcBuffer:          50000,
+		Verbosity:           ctrl.Verbosity(c.Int("verbosity")),
+		Adversary:           c.Generic("adversary").(*EnumValue).String(),
+		AdversaryDelay:      c.Duration("adv-delay"),
+		ByzantineSource:     c.Bool("byz-source"),
+		DeliverTimeout:      c.Duration("deliver-timeout"),
+		Placement:           c.Generic("placement").(*EnumValue).String(),
+		PlacementSeed:       c.Int64("placement-seed"),
+		ByzantineNodes:      nodeIds(c.Int64Slice("byz-nodes")),
+		AdaptiveCorruptions: c.Int("adaptive"),
+		AdaptiveDelay:       c.Duration("adaptive-delay"),
+		AdaptiveTarget:      c.Generic("adaptive-target").(*EnumValue).String(),
+		Simulated:           c.Bool("simulate"),
+		Links:               links,
+		Partitions:          parts,
+		Scheduler:           scheduler(c, seed),
+		Seed:                seed,
+		Transport:           transport(c),
+		AddressBook:         book,
+		Authenticate:        c.Bool("authenticate"),
 	}
 	cfg := process.Config{
-		MaxRetries:     5,
-		RetryDelay:     time.Millisecond * 100,
-		NeighbourDelay: time.Millisecond * 300,
+		MaxRetries:        5,
+		RetryDelay:        time.Millisecond * 100,
+		NeighbourDelay:    time.Millisecond * 300,
+		Reliable:          c.Bool("reliable"),
+		RetransmitTimeout: c.Duration("retransmit"),
+		QueueSize:         c.Int("queue-size"),
+		Overflow:          overflowPolicy(c),
+		SpillDir:          c.String("spill-dir"),
 	}
 
 	// Optimizations
@@ -238,6 +626,7 @@ func runTemplate(c *cli.Context) error {
 		DolevImplicitPath:           c.Bool("ord7"),
 		BrachaImplicitEcho:          c.Bool("orb1"),
 		BrachaMinimalSubset:         c.Bool("orb2"),
+		BrachaDigest:                c.Bool("orb3"),
 		BrachaDolevPartialBroadcast: c.Bool("orbd1"),
 		BrachaDolevMerge:            c.Bool("orbd2"),
 	}
@@ -273,21 +662,62 @@ func runTemplate(c *cli.Context) error {
 		brachaFullTests(opts, info, cfg, payloadSize, runs, multiple, skip)
 	case "brachaScaleTests":
 		brachaScaleTests(opts, info, cfg, payloadSize, runs, multiple, skip)
+	case "payloadSweepTests":
+		payloadSweepTests(opts, info, cfg, runs, multiple, skip)
 	}
 	return nil
 }
 
 func runSingle(c *cli.Context) error {
+	seed := globalSeed(c)
+	links, err := linkModel(c, seed)
+	if err != nil {
+		return err
+	}
+
+	parts, err := partitions(c)
+	if err != nil {
+		return err
+	}
+
+	book, err := addressBook(c)
+	if err != nil {
+		return err
+	}
+
 	info := ctrl.Config{
-		PollDelay:  time.Millisecond * 200,
-		CtrlBuffer: 2000,
-		ProcBuffer: 50000,
-		Verbosity:  ctrl.Verbosity(c.Int("verbosity")),
+		PollDelay:           time.Millisecond * 200,
+		CtrlBuffer:          2000,
+		ProcBuffer:          50000,
+		Verbosity:           ctrl.Verbosity(c.Int("verbosity")),
+		Adversary:           c.Generic("adversary").(*EnumValue).String(),
+		AdversaryDelay:      c.Duration("adv-delay"),
+		ByzantineSource:     c.Bool("byz-source"),
+		DeliverTimeout:      c.Duration("deliver-timeout"),
+		Placement:           c.Generic("placement").(*EnumValue).String(),
+		PlacementSeed:       c.Int64("placement-seed"),
+		ByzantineNodes:      nodeIds(c.Int64Slice("byz-nodes")),
+		AdaptiveCorruptions: c.Int("adaptive"),
+		AdaptiveDelay:       c.Duration("adaptive-delay"),
+		AdaptiveTarget:      c.Generic("adaptive-target").(*EnumValue).String(),
+		Simulated:           c.Bool("simulate"),
+		Links:               links,
+		Partitions:          parts,
+		Scheduler:           scheduler(c, seed),
+		Seed:                seed,
+		Transport:           transport(c),
+		AddressBook:         book,
+		Authenticate:        c.Bool("authenticate"),
 	}
 	cfg := process.Config{
-		MaxRetries:     5,
-		RetryDelay:     time.Millisecond * 100,
-		NeighbourDelay: time.Millisecond * 300,
+		MaxRetries:        5,
+		RetryDelay:        time.Millisecond * 100,
+		NeighbourDelay:    time.Millisecond * 300,
+		Reliable:          c.Bool("reliable"),
+		RetransmitTimeout: c.Duration("retransmit"),
+		QueueSize:         c.Int("queue-size"),
+		Overflow:          overflowPolicy(c),
+		SpillDir:          c.String("spill-dir"),
 	}
 
 	// Optimizations
@@ -301,6 +731,7 @@ func runSingle(c *cli.Context) error {
 		DolevImplicitPath:           c.Bool("ord7"),
 		BrachaImplicitEcho:          c.Bool("orb1"),
 		BrachaMinimalSubset:         c.Bool("orb2"),
+		BrachaDigest:                c.Bool("orb3"),
 		BrachaDolevPartialBroadcast: c.Bool("orbd1"),
 		BrachaDolevMerge:            c.Bool("orbd2"),
 	}
@@ -319,10 +750,18 @@ func runSingle(c *cli.Context) error {
 
 	var br brb.Protocol
 	switch c.Generic("protocol").(*EnumValue).selected {
+	case "dolevUnknown":
+		br = &brb.DolevUnknown{}
 	case "bracha":
 		br = &brb.BrachaImproved{}
 	case "brachaDolev":
 		br = &brb.BrachaDolevKnownImproved{}
+	case "signedEcho":
+		br = &brb.SignedEcho{}
+	case "signedEchoDolev":
+		br = &brb.SignedEchoDolev{}
+	case "avid":
+		br = &brb.Avid{}
 	default:
 		br = &brb.DolevKnownImproved{}
 	}
@@ -351,3 +790,12 @@ func runSingle(c *cli.Context) error {
 
 	return runMultipleMessagesTest(runCfg, false)
 }
+
+func nodeIds(ids []int64) []uint64 {
+	res := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, uint64(id))
+	}
+
+	return res
+}
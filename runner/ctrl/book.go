@@ -0,0 +1,80 @@
+package ctrl
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AddressBook contains the addresses of the controller and all processes, so processes can run on different hosts
+type AddressBook struct {
+	// File the address book was read from, processes started by the controller read the same file
+	Path string
+
+	Controller string
+	Processes  map[uint64]string
+}
+
+// ReadAddressBook reads an address book from a file. Every line is written as "<id> <host:port>", where id is the id of
+// a process or "controller". Empty lines and lines starting with # are ignored.
+func ReadAddressBook(name string) (*AddressBook, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open address book")
+	}
+	defer f.Close()
+
+	res := &AddressBook{Path: name, Processes: make(map[uint64]string)}
+
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("line %v of address book should be written as <id> <host:port>", line)
+		}
+
+		if _, _, err := net.SplitHostPort(fields[1]); err != nil {
+			return nil, errors.Wrapf(err, "line %v of address book", line)
+		}
+
+		if fields[0] == "controller" {
+			res.Controller = fields[1]
+			continue
+		}
+
+		id, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %v of address book", line)
+		}
+		res.Processes[id] = fields[1]
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read address book")
+	}
+
+	if res.Controller == "" {
+		return nil, errors.New("address book does not contain the controller")
+	}
+
+	return res, nil
+}
+
+// Local returns whether process id listens on a loopback address, these processes are started by the controller
+func (a *AddressBook) Local(id uint64) bool {
+	host, _, err := net.SplitHostPort(a.Processes[id])
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
@@ -0,0 +1,191 @@
+package ctrl
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"rp-runner/brb/algo"
+	"rp-runner/graphs"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Target ranks the correct processes (excluding possible transmitters) for adaptive corruption, the most interesting
+// targets for the broadcasts with the given uids first
+type Target func(c *Controller, uids []uint32) ([]uint64, error)
+
+// Targets contains all adaptive corruption targets by name, these names are also used by the CLI
+var Targets = map[string]Target{
+	"active": activeTarget,
+	"paths":  pathsTarget,
+	"subset": subsetTarget,
+}
+
+// TargetNames returns the (sorted) names of all available adaptive corruption targets
+func TargetNames() []string {
+	res := make([]string, 0, len(Targets))
+	for name := range Targets {
+		res = append(res, name)
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+// candidates returns the processes that can be corrupted, with the sources of the given broadcasts
+func (c *Controller) candidates(uids []uint32) ([]uint64, []uint64) {
+	c.dLock.Lock()
+	sources := make([]uint64, 0, len(uids))
+	for _, uid := range uids {
+		sources = append(sources, c.originMap[uid])
+	}
+	c.dLock.Unlock()
+
+	c.pLock.Lock()
+	defer c.pLock.Unlock()
+
+	res := make([]uint64, 0, len(c.p))
+	for id, p := range c.p {
+		if _, ok := c.transmitters[id]; !p.byz && !ok {
+			res = append(res, id)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+
+	return res, sources
+}
+
+// activeTarget prefers the processes that sent the most messages for the broadcasts so far
+func activeTarget(c *Controller, uids []uint32) ([]uint64, error) {
+	return c.MostActive(uids...), nil
+}
+
+// pathsTarget prefers the processes on the most disjoint paths of the routing tables of the sources
+func pathsTarget(c *Controller, uids []uint32) ([]uint64, error) {
+	nodes, sources := c.candidates(uids)
+	on := make(map[uint64]int, len(nodes))
+
+	for _, s := range sources {
+		routes, err := algo.BuildRoutingTable(c.graph, graphs.Node{Id: int64(s), Name: strconv.Itoa(int(s))},
+			2*c.f+1, 0, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to build routing table of %v", s)
+		}
+
+		for _, paths := range routes {
+			for _, p := range paths {
+				for _, e := range p.P[:len(p.P)-1] {
+					on[uint64(e.To().ID())] += 1
+				}
+			}
+		}
+	}
+
+	return rank(nodes, func(n uint64) float64 {
+		return float64(on[n])
+	}), nil
+}
+
+// subsetTarget prefers the processes in the Bracha minimal subset of the sources, processes earlier in the subset
+// also take part in the ready phase so they are preferred
+func subsetTarget(c *Controller, uids []uint32) ([]uint64, error) {
+	nodes, sources := c.candidates(uids)
+	all, _ := graphs.Nodes(c.graph)
+
+	var inclusion algo.BrachaInclusionTable
+	if c.bd {
+		inclusion = algo.FindBrachaDolevInclusionTable(c.graph, all, len(all), c.f)
+	} else {
+		inclusion = algo.FindBrachaInclusionTable(c.graph, all, len(all), c.f)
+	}
+
+	score := make(map[uint64]float64, len(nodes))
+	for _, s := range sources {
+		included := inclusion[s]
+		for i, n := range included {
+			score[n] += float64(len(included) - i)
+		}
+	}
+
+	return rank(nodes, func(n uint64) float64 {
+		return score[n]
+	}), nil
+}
+
+// CorruptAdaptive corrupts the most interesting correct process for the given broadcasts using the configured
+// target, as long as adaptive corruptions are left. It returns the corrupted process, if any.
+func (c *Controller) CorruptAdaptive(uids ...uint32) (uint64, bool, error) {
+	c.pLock.Lock()
+	left := c.corrupted < c.cfg.AdaptiveCorruptions
+	c.pLock.Unlock()
+
+	if !left {
+		return 0, false, nil
+	}
+
+	name := c.cfg.AdaptiveTarget
+	if name == "" {
+		name = "active"
+	}
+
+	target, ok := Targets[name]
+	if !ok {
+		return 0, false, errors.Errorf("unknown adaptive corruption target: %v", name)
+	}
+
+	targets, err := target(c, uids)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "failed to pick adaptive corruption target (%v)", name)
+	}
+
+	if len(targets) == 0 {
+		return 0, false, nil
+	}
+
+	if err := c.Corrupt(targets[0]); err != nil {
+		return 0, false, err
+	}
+
+	c.pLock.Lock()
+	c.corrupted += 1
+	c.pLock.Unlock()
+
+	return targets[0], true, nil
+}
+
+// ScheduleCorruption corrupts a process AdaptiveDelay after the broadcasts were sent, while correct processes are
+// still waiting to deliver them. When simulated the delay is virtual. Corruptions that did not happen before the
+// processes are flushed are cancelled.
+func (c *Controller) ScheduleCorruption(uids ...uint32) {
+	c.pLock.Lock()
+	flushes := c.flushes
+	c.pLock.Unlock()
+
+	corrupt := func() {
+		c.pLock.Lock()
+		cancelled := flushes != c.flushes
+		c.pLock.Unlock()
+
+		if cancelled {
+			return
+		}
+
+		id, ok, err := c.CorruptAdaptive(uids...)
+		switch {
+		case err != nil:
+			fmt.Printf("unable to corrupt process: %v\n", err)
+		case ok && c.cfg.Verbosity > SILENT:
+			fmt.Printf("corrupted process %v after %v\n", id, c.cfg.AdaptiveDelay)
+		}
+	}
+
+	if c.sim != nil {
+		c.sim.After(c.cfg.AdaptiveDelay, corrupt)
+		return
+	}
+
+	time.AfterFunc(c.cfg.AdaptiveDelay, corrupt)
+}
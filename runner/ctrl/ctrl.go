@@ -6,18 +6,29 @@ import (
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/simple"
 	"math/rand"
-	"os"
+	"net"
 	"reflect"
 	"rp-runner/brb"
 	"rp-runner/brb/algo"
+	"rp-runner/graphs"
 	"rp-runner/msg"
 	"rp-runner/process"
+	"sort"
 	"sync"
 	"time"
 )
 
+// handle controls a process, which runs either in the OS process of the controller or in a child OS process
+type handle interface {
+	Start(channels map[uint64]chan process.Message) error
+	Stats() process.Stats
+	QueueStats() map[uint64]process.QueueStats
+	Flush()
+	StopFlush()
+}
+
 type proc struct {
-	p                 *process.Process
+	p                 handle
 	alive, ready, byz bool
 
 	err error
@@ -36,6 +47,53 @@ type Config struct {
 	CtrlBuffer, ProcBuffer, intermediateInterval int
 	PollDelay                                    time.Duration
 	Verbosity                                    Verbosity
+
+	// Name of the strategy used by Byzantine processes (see brb.Adversaries), adversaries that hold messages hold
+	// them for at most AdversaryDelay
+	Adversary      string
+	AdversaryDelay time.Duration
+
+	// Makes all possible transmitters Byzantine. Correct processes are not required to deliver broadcasts from
+	// Byzantine sources, so waiting for deliveries of those broadcasts stops after DeliverTimeout.
+	ByzantineSource bool
+	DeliverTimeout  time.Duration
+
+	// Name of the strategy used to place Byzantine processes (see Placements), the seed is used by the random
+	// placement and ByzantineNodes by the explicit placement
+	Placement      string
+	PlacementSeed  int64
+	ByzantineNodes []uint64
+
+	// Amount of the F Byzantine processes that are not placed at the start, but corrupted during the test. Processes
+	// are corrupted AdaptiveDelay after the broadcasts of a run are sent, or between runs if 0. The corrupted
+	// processes are picked using AdaptiveTarget (see Targets).
+	AdaptiveCorruptions int
+	AdaptiveDelay       time.Duration
+	AdaptiveTarget      string
+
+	// Use a discrete-event simulation with the given links instead of running all processes concurrently, latencies
+	// are measured using a virtual clock. The loss of messages is also applied when not simulated.
+	Simulated bool
+	Links     process.LinkModel
+
+	// Links are cut according to the schedule if set, which starts with the first broadcast of every run
+	Partitions *process.Partitions
+
+	// Simulates using an adversarial order of messages if set, every run uses the next seed
+	Scheduler *process.Scheduler
+
+	// Seed of all randomness used by the controller and processes, such as uids, placements and lost messages
+	Seed int64
+
+	// Determines how processes are connected, processes connected over TCP can not be simulated or partitioned
+	Transport Transport
+
+	// Authenticate all links between processes using pairwise keys, so Byzantine processes can not impersonate others
+	Authenticate bool
+
+	// Processes connected over TCP join the controller at the addresses in the address book if set, instead of being
+	// started as child OS processes connected using pipes
+	AddressBook *AddressBook
 }
 
 type Controller struct {
@@ -46,14 +104,38 @@ type Controller struct {
 
 	stopCh chan struct{}
 
-	p     map[uint64]proc
-	pLock sync.Mutex
+	p         map[uint64]proc
+	byzantine []uint64
+	pLock     sync.Mutex
+
+	// Amount of adaptive corruptions so far, and the amount of flushes which cancels scheduled corruptions
+	corrupted, flushes int
+
+	f            int
+	graph        *simple.WeightedUndirectedGraph
+	bd           bool
+	transmitters map[uint64]struct{}
+	coordinator  *brb.Coordinator
+	sim          *process.Simulator
+	rand         *rand.Rand
+
+	// Addresses of the processes running in other OS processes
+	book map[uint64]string
+
+	// Accepts the processes of the address book, which join using the channel of their id
+	listener net.Listener
+	arrivals map[uint64]chan remoteConn
 
 	payloadMap map[uint32]interface{}
 	deliverMap map[uint32]map[uint64]struct{}
 	sendMap    map[uint32]time.Time
+	originMap  map[uint32]uint64
 	dLock      sync.Mutex
 
+	// Payload delivered first by a correct process, used to check agreement
+	agreedMap  map[uint32]interface{}
+	violations map[uint32][]Violation
+
 	al, rdy int
 }
 
@@ -69,6 +151,14 @@ func StartController(cfg Config) (*Controller, error) {
 		cfg.intermediateInterval = 1
 	}
 
+	if cfg.DeliverTimeout == 0 {
+		cfg.DeliverTimeout = time.Second * 5
+	}
+
+	if cfg.AdversaryDelay == 0 {
+		cfg.AdversaryDelay = time.Second
+	}
+
 	c := &Controller{
 		ctl:        make(chan process.Message, cfg.CtrlBuffer),
 		channels:   make(map[uint64]chan process.Message),
@@ -78,13 +168,57 @@ func StartController(cfg Config) (*Controller, error) {
 		payloadMap: make(map[uint32]interface{}),
 		deliverMap: make(map[uint32]map[uint64]struct{}),
 		sendMap:    make(map[uint32]time.Time),
+		originMap:  make(map[uint32]uint64),
+		agreedMap:  make(map[uint32]interface{}),
+		violations: make(map[uint32][]Violation),
+		rand:       rand.New(rand.NewSource(cfg.Seed)),
+		book:       make(map[uint64]string),
 	}
+
+	if cfg.Transport == TCPTransport && (cfg.Simulated || cfg.Scheduler != nil || cfg.Partitions != nil) {
+		return nil, errors.New("processes connected over tcp can not be simulated, scheduled or partitioned")
+	}
+
+	// Every OS process has its own coordinator, so colluding adversaries would quietly stop colluding
+	if adv, err := brb.NewAdversary(cfg.Adversary); err == nil && cfg.Transport == TCPTransport {
+		if _, ok := adv.(brb.Colluding); ok {
+			return nil, errors.Errorf("colluding adversary %v can not be used by processes connected over tcp", cfg.Adversary)
+		}
+	}
+
+	if book := cfg.AddressBook; book != nil {
+		if cfg.Transport != TCPTransport {
+			return nil, errors.New("an address book can only be used by processes connected over tcp")
+		}
+
+		l, err := net.Listen("tcp", book.Controller)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to listen for processes")
+		}
+
+		c.listener = l
+		c.arrivals = make(map[uint64]chan remoteConn, len(book.Processes))
+		for id := range book.Processes {
+			c.arrivals[id] = make(chan remoteConn, 1)
+		}
+		go c.accept(l)
+	}
+
+	if cfg.Simulated || cfg.Scheduler != nil {
+		c.sim = process.NewSimulator(cfg.Links)
+		c.sim.Scheduler = cfg.Scheduler
+	}
+
 	go c.run()
 
 	return c, nil
 }
 
 func (c *Controller) startProcess(cfg process.Config, bp brb.Protocol) error {
+	cfg.Simulator = c.sim
+	cfg.Links = c.cfg.Links
+	cfg.Partitions = c.cfg.Partitions
+
 	c.pLock.Lock()
 	p, err := process.StartProcess(cfg.ByzConfig.Id, cfg, c.stopCh, cfg.ByzConfig.Neighbours, bp, c.ctl)
 	if err != nil {
@@ -101,10 +235,25 @@ func (c *Controller) FlushProcesses() {
 	c.pLock.Lock()
 	defer c.pLock.Unlock()
 
+	// Cancels corruptions scheduled during the run
+	c.flushes += 1
+
 	for _, p := range c.p {
 		p.p.Flush()
 	}
 
+	if c.sim != nil {
+		c.sim.Clear()
+	}
+
+	if c.cfg.Partitions != nil {
+		c.cfg.Partitions.Stop()
+	}
+
+	if c.cfg.Scheduler != nil {
+		c.cfg.Scheduler.Reset(c.cfg.Scheduler.Seed() + 1)
+	}
+
 	// TODO: make better
 	time.Sleep(time.Second * 3)
 
@@ -116,33 +265,115 @@ func (c *Controller) FlushProcesses() {
 	time.Sleep(time.Millisecond * 400)
 }
 
-// TODO: random byzantine nodes?
-func (c *Controller) StartProcesses(cfg process.Config, opt brb.OptimizationConfig, g *simple.WeightedUndirectedGraph, bp brb.Protocol, F int, possibleTransmitters []uint64, allTransmit bool) error {
+// Byzantine processes are picked using the configured placement, after which the possible transmitters are picked
+// among the correct processes: possibleTransmitters are indices in the (sorted) correct processes. If the controller
+// is configured with a Byzantine source, or the placement depends on the sources, the possible transmitters are
+// indices in all (sorted) processes instead and are picked first. With a Byzantine source they are all Byzantine. The
+// ids of the possible transmitters are returned.
+func (c *Controller) StartProcesses(cfg process.Config, opt brb.OptimizationConfig, g *simple.WeightedUndirectedGraph, bp brb.Protocol, F int, possibleTransmitters []uint64, allTransmit bool) ([]uint64, error) {
 	nodes := g.Nodes()
 	byzLeft := F
 	N := nodes.Len()
 
-	transmitCheck := make(map[uint64]struct{}, len(possibleTransmitters))
+	distinct := make(map[uint64]struct{}, len(possibleTransmitters))
 	for _, t := range possibleTransmitters {
-		transmitCheck[t] = struct{}{}
+		distinct[t] = struct{}{}
+	}
+
+	if r := len(distinct); c.cfg.ByzantineSource && r > F {
+		return nil, errors.Errorf("not enough byzantine nodes (%v) to make all %v possible transmitters byzantine", F, r)
+	} else if !c.cfg.ByzantineSource && N-r < F {
+		return nil, errors.Errorf("not enough nodes to support %v possible transmitters with %v byzantine nodes", r, F)
+	}
+
+	if c.cfg.ByzantineSource {
+		byzLeft -= len(distinct)
 	}
 
-	if r := len(transmitCheck); N-r < F {
-		return errors.Errorf("not enough nodes to support %v possible transmitters with %v byzantine nodes", r, F)
+	if byzLeft -= c.cfg.AdaptiveCorruptions; byzLeft < 0 {
+		return nil, errors.Errorf("not enough byzantine nodes (%v) for %v adaptive corruptions", F, c.cfg.AdaptiveCorruptions)
 	}
 
-	var fullTable *algo.FullRoutingTable
-	if opt.DolevImplicitPath {
-		w := 0
-		if opt.DolevReusePaths {
-			w = N / 10
+	transmitters := make([]uint64, len(possibleTransmitters))
+	transmitCheck := make(map[uint64]struct{}, len(distinct))
+	pick := func(from []uint64) error {
+		for i, t := range possibleTransmitters {
+			if t >= uint64(len(from)) {
+				return errors.Errorf("possible transmitter %v does not exist, only %v candidates", t, len(from))
+			}
+
+			transmitters[i] = from[t]
+			transmitCheck[from[t]] = struct{}{}
 		}
 
-		var err error
-		fullTable, err = algo.BuildFullRoutingTable(g, w, N, F, F*2+1, opt.DolevSingleHopNeighbour,
-			opt.DolevCombineNextHops, opt.DolevFilterSubpaths, bp.Category() == brb.BrachaDolevCat)
-		if err != nil {
-			return errors.Wrap(err, "failed to build full routing table")
+		return nil
+	}
+
+	sourcesFirst := c.cfg.ByzantineSource || placementUsesSources(c.cfg.Placement)
+	if sourcesFirst {
+		if err := pick(sortedNodes(g)); err != nil {
+			return nil, err
+		}
+	}
+
+	var sources []uint64
+	if sourcesFirst {
+		sources = transmitters
+	}
+
+	placed, err := c.placeByzantine(g, sources, transmitCheck, byzLeft)
+	if err != nil {
+		return nil, err
+	}
+
+	byzantine := make(map[uint64]struct{}, F)
+	for _, n := range placed {
+		byzantine[n] = struct{}{}
+	}
+
+	if c.cfg.ByzantineSource {
+		for t := range transmitCheck {
+			byzantine[t] = struct{}{}
+			placed = append(placed, t)
+		}
+	}
+
+	if !sourcesFirst {
+		correct := make([]uint64, 0, N-len(placed))
+		for _, n := range sortedNodes(g) {
+			if _, ok := byzantine[n]; !ok {
+				correct = append(correct, n)
+			}
+		}
+
+		if err := pick(correct); err != nil {
+			return nil, err
+		}
+	}
+
+	// All Byzantine processes share a coordinator, which is used by colluding adversaries
+	coordinator := brb.NewCoordinator(g, F, placed)
+	c.coordinator = coordinator
+	c.f = F
+	c.graph = g
+	c.bd = bp.Category() == brb.BrachaDolevCat
+	c.transmitters = transmitCheck
+
+	fullTable, err := fullRoutingTable(g, opt, N, F, bp)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, _ := graphs.Nodes(g)
+	signing, err := brb.GenerateSignatureKeys(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys map[uint64]map[uint64][]byte
+	if c.cfg.Authenticate {
+		if keys, err = process.LinkKeys(graphEdges(g)); err != nil {
+			return nil, err
 		}
 	}
 
@@ -154,17 +385,24 @@ func (c *Controller) StartProcesses(cfg process.Config, opt brb.OptimizationConf
 		for to.Next() {
 			neighbours = append(neighbours, uint64(to.Node().ID()))
 		}
+		sort.Slice(neighbours, func(i, j int) bool {
+			return neighbours[i] < neighbours[j]
+		})
 
 		pg := simple.NewWeightedUndirectedGraph(0, 0)
 		graph.CopyWeighted(pg, g)
 
 		_, possibleTransmitter := transmitCheck[uint64(n.ID())]
-		byz := byzLeft > 0 && !possibleTransmitter
+		_, byz := byzantine[uint64(n.ID())]
 		if byz {
-			byzLeft -= 1
+			c.byzantine = append(c.byzantine, uint64(n.ID()))
 		}
 
 		pcfg := cfg
+		pcfg.Seed = c.cfg.Seed + n.ID()
+		if keys != nil {
+			pcfg.Keys = keys[uint64(n.ID())]
+		}
 		pcfg.ByzConfig = brb.Config{
 			Byz:                byz,
 			F:                  F,
@@ -176,30 +414,181 @@ func (c *Controller) StartProcesses(cfg process.Config, opt brb.OptimizationConf
 			OptimizationConfig: opt,
 			Precomputed:        brb.PrecomputedValues{FullTable: fullTable},
 			Silent:             c.cfg.Verbosity == SILENT,
+			Signing:            signing[uint64(n.ID())],
 		}
 
 		if allTransmit {
 			pcfg.ByzConfig.Unused = false
 		}
 
-		if err := c.startProcess(pcfg, reflect.New(reflect.ValueOf(bp).Elem().Type()).Interface().(brb.Protocol)); err != nil {
-			return errors.Wrap(err, "failed to create process")
+		if c.cfg.Transport == TCPTransport {
+			if err := c.startRemote(pcfg, bp, placed); err != nil {
+				return nil, errors.Wrap(err, "failed to create process")
+			}
+			continue
+		}
+
+		np := reflect.New(reflect.ValueOf(bp).Elem().Type()).Interface().(brb.Protocol)
+		if byz {
+			adv, err := newAdversary(c.cfg.Adversary, c.cfg.AdversaryDelay)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to create adversary")
+			}
+
+			if col, ok := adv.(brb.Colluding); ok {
+				col.Join(coordinator)
+			}
+
+			np = &brb.Byzantine{Honest: np, Adv: adv}
+		} else {
+			np = &brb.Corruptible{Honest: np}
+		}
+
+		if err := c.startProcess(pcfg, np); err != nil {
+			return nil, errors.Wrap(err, "failed to create process")
 		}
 	}
 
 	c.pLock.Lock()
 	for _, p := range c.p {
 		if err := p.p.Start(c.channels); err != nil {
-			return errors.Wrap(err, "failed to start process")
+			return nil, errors.Wrap(err, "failed to start process")
 		}
 	}
 	c.pLock.Unlock()
 
+	return transmitters, nil
+}
+
+// graphEdges returns all edges of the graph as pairs of process ids
+func graphEdges(g *simple.WeightedUndirectedGraph) [][2]uint64 {
+	var res [][2]uint64
+
+	edges := g.Edges()
+	for edges.Next() {
+		e := edges.Edge()
+		res = append(res, [2]uint64{uint64(e.From().ID()), uint64(e.To().ID())})
+	}
+
+	return res
+}
+
+// fullRoutingTable precomputes the routes used by the implicit path optimization, it is nil without the optimization
+func fullRoutingTable(g *simple.WeightedUndirectedGraph, opt brb.OptimizationConfig, N, F int, bp brb.Protocol) (*algo.FullRoutingTable, error) {
+	if !opt.DolevImplicitPath {
+		return nil, nil
+	}
+
+	w := 0
+	if opt.DolevReusePaths {
+		w = N / 10
+	}
+
+	fullTable, err := algo.BuildFullRoutingTable(g, w, N, F, F*2+1, opt.DolevSingleHopNeighbour,
+		opt.DolevCombineNextHops, opt.DolevFilterSubpaths, bp.Category() == brb.BrachaDolevCat)
+
+	return fullTable, errors.Wrap(err, "failed to build full routing table")
+}
+
+func newAdversary(name string, delay time.Duration) (brb.Adversary, error) {
+	adv, err := brb.NewAdversary(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := adv.(brb.DelayingAdversary); ok {
+		d.SetMaxDelay(delay)
+	}
+
+	return adv, nil
+}
+
+// ByzantineNodes returns the (sorted) ids of all Byzantine processes
+func (c *Controller) ByzantineNodes() []uint64 {
+	c.pLock.Lock()
+	defer c.pLock.Unlock()
+
+	res := make([]uint64, len(c.byzantine))
+	copy(res, c.byzantine)
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+
+	return res
+}
+
+// Corrupt hands control over correct process id to the configured adversary, keeping the state of the process. At
+// most F processes can be Byzantine in total.
+func (c *Controller) Corrupt(id uint64) error {
+	adv, err := newAdversary(c.cfg.Adversary, c.cfg.AdversaryDelay)
+	if err != nil {
+		return errors.Wrap(err, "failed to create adversary")
+	}
+
+	c.pLock.Lock()
+	p, ok := c.p[id]
+	switch {
+	case !ok:
+		c.pLock.Unlock()
+		return errors.Errorf("unknown process: %v", id)
+	case p.byz:
+		c.pLock.Unlock()
+		return errors.Errorf("process %v is already byzantine", id)
+	case len(c.byzantine) >= c.f:
+		c.pLock.Unlock()
+		return errors.Errorf("unable to corrupt process %v, already %v byzantine processes", id, c.f)
+	}
+
+	p.byz = true
+	c.p[id] = p
+	c.byzantine = append(c.byzantine, id)
+	c.pLock.Unlock()
+
+	c.coordinator.Corrupt(id)
+	if col, ok := adv.(brb.Colluding); ok {
+		col.Join(c.coordinator)
+	}
+
+	c.send(id, msg.CorruptType, msg.CorruptMessage{Adversary: adv})
+
 	return nil
 }
 
+// MostActive returns the correct processes (excluding possible transmitters) ordered by the amount of messages they
+// sent for the given broadcasts, which are the most interesting targets for adaptive corruption
+func (c *Controller) MostActive(uids ...uint32) []uint64 {
+	c.pLock.Lock()
+	defer c.pLock.Unlock()
+
+	sent := make(map[uint64]int, len(c.p))
+	res := make([]uint64, 0, len(c.p))
+	for id, p := range c.p {
+		if _, ok := c.transmitters[id]; p.byz || ok {
+			continue
+		}
+
+		s := p.p.Stats()
+		for _, uid := range uids {
+			sent[id] += s.MsgSent[uid]
+		}
+		res = append(res, id)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if sent[res[i]] == sent[res[j]] {
+			return res[i] < res[j]
+		}
+
+		return sent[res[i]] > sent[res[j]]
+	})
+
+	return res
+}
+
 func (c *Controller) TriggerMessageSend(id uint64, payload brb.Size) (uint32, error) {
-	uid := rand.Uint32()
+	c.dLock.Lock()
+	uid := c.rand.Uint32()
+	c.dLock.Unlock()
 
 	m := msg.TriggerMessage{Id: uid, Payload: payload}
 
@@ -213,9 +602,14 @@ func (c *Controller) TriggerMessageSend(id uint64, payload brb.Size) (uint32, er
 	c.dLock.Lock()
 	c.payloadMap[uid] = payload
 	c.deliverMap[uid] = make(map[uint64]struct{})
-	c.sendMap[uid] = time.Now()
+	c.sendMap[uid] = c.now()
+	c.originMap[uid] = id
 	c.dLock.Unlock()
 
+	if c.cfg.Partitions != nil {
+		c.cfg.Partitions.Start(c.sendMap[uid])
+	}
+
 	c.send(id, msg.TriggerMessageType, m)
 
 	return uid, nil
@@ -268,6 +662,10 @@ func (c *Controller) WaitForReady() error {
 }
 
 func (c *Controller) WaitForDeliver(uid uint32) Stats {
+	c.dLock.Lock()
+	origin := c.originMap[uid]
+	c.dLock.Unlock()
+
 	c.pLock.Lock()
 	needed := make(map[uint64]struct{})
 	for pid, p := range c.p {
@@ -275,20 +673,59 @@ func (c *Controller) WaitForDeliver(uid uint32) Stats {
 			needed[pid] = struct{}{}
 		}
 	}
+	byzSource := c.p[origin].byz
 	c.pLock.Unlock()
 
+	start := time.Now()
+	progress := start
 	i := 0
 	for {
+		if c.sim != nil {
+			c.sim.Run()
+		}
+
 		c.dLock.Lock()
 		for pid := range c.deliverMap[uid] {
-			delete(needed, pid)
+			if _, ok := needed[pid]; ok {
+				delete(needed, pid)
+				progress = time.Now()
+			}
 		}
 		c.dLock.Unlock()
 
+		// Processes can be corrupted while waiting
+		c.pLock.Lock()
+		for pid := range needed {
+			if c.p[pid].byz {
+				delete(needed, pid)
+			}
+		}
+		c.pLock.Unlock()
+
 		if len(needed) == 0 {
 			return c.aggregateStats(uid)
 		}
 
+		// No messages are left in the simulation, so the remaining processes will never deliver
+		if c.sim != nil && !byzSource && c.sim.Idle() && time.Since(progress) > c.cfg.DeliverTimeout {
+			if c.cfg.Verbosity > SILENT {
+				fmt.Printf("stopped waiting for %v more (%v) delivers, no messages are left: %v\n", len(needed), uid,
+					needed)
+			}
+
+			stats := c.aggregateStats(uid)
+			stats.Stuck = true
+			return stats
+		}
+
+		if byzSource && time.Since(start) > c.cfg.DeliverTimeout {
+			if c.cfg.Verbosity > SILENT {
+				fmt.Printf("stopped waiting for %v more (%v) delivers, source %v is byzantine\n", len(needed), uid, origin)
+			}
+
+			return c.aggregateStats(uid)
+		}
+
 		if i == 0 && c.cfg.Verbosity > SILENT {
 			fmt.Printf("waiting for %v more (%v) delivers: %v\n", len(needed), uid, needed)
 		}
@@ -307,17 +744,49 @@ func (c *Controller) aggregateStats(uid uint32) Stats {
 	recv := 0
 	bdMerged := 0
 	minRecv, maxRecv := -1, -1
-	transmitted := 0
+	transmitted, estimated := 0, 0
 	dMerged := 0
 	pMerged := 0
+	malformed := 0
+	dropped := 0
+	retransmitted := 0
+	acks := 0
+	partitioned := 0
+	forged := 0
+	requested := 0
+	beforeHeal, afterHeal := 0, 0
+
+	var healed time.Time
+	if c.cfg.Partitions != nil {
+		healed = c.cfg.Partitions.Healed()
+	}
 
-	for _, p := range c.p {
+	var seed int64
+	if c.cfg.Scheduler != nil {
+		seed = c.cfg.Scheduler.Seed()
+	}
+
+	c.dLock.Lock()
+	delivered := len(c.deliverMap[uid])
+	violations := append([]Violation(nil), c.violations[uid]...)
+	c.dLock.Unlock()
+
+	for pid, p := range c.p {
 		s := p.p.Stats()
 		del := s.Deliveries[uid]
 		c.dLock.Lock()
 		lat := del.Sub(c.sendMap[uid])
+		_, ok := c.deliverMap[uid][pid]
 		c.dLock.Unlock()
 
+		if ok && c.cfg.Partitions != nil {
+			if del.Before(healed) {
+				beforeHeal += 1
+			} else {
+				afterHeal += 1
+			}
+		}
+
 		if lat > latency {
 			latency = lat
 		}
@@ -328,43 +797,125 @@ func (c *Controller) aggregateStats(uid uint32) Stats {
 		cnt += s.MsgSent[uid]
 		dMerged += s.DMerged[uid]
 		transmitted += int(s.BytesTransmitted[uid])
+		estimated += int(s.EstimatedBytes[uid])
 		pMerged += s.PayloadsMerged[uid]
-
+		malformed += s.Malformed[uid]
+		dropped += s.Dropped[uid]
+		retransmitted += s.Retransmitted[uid]
+		acks += s.Acks[uid]
+		partitioned += s.Partitioned[uid]
+		forged += s.Forged[uid]
+		requested += s.Requested[uid]
+
+		// Both bounds are updated for every process, so they do not depend on the order of the map
 		if rec > maxRecv {
 			maxRecv = rec
-		} else if rec < minRecv || minRecv == -1 {
+		}
+		if rec < minRecv || minRecv == -1 {
 			minRecv = rec
 		}
 	}
 
 	return Stats{
-		Latency:          latency,
-		MsgCount:         cnt,
-		RelayCnt:         recv,
-		MeanRelayCount:   float64(recv) / float64(len(c.p)-1),
-		MinRelayCnt:      minRecv,
-		MaxRelayCnt:      maxRecv,
-		BDMessagedMerged: bdMerged,
-		BytesTransmitted: transmitted,
-		DMessagesMerged:  dMerged,
-		PayloadsMerged:   pMerged,
+		Latency:             latency,
+		MsgCount:            cnt,
+		RelayCnt:            recv,
+		MeanRelayCount:      float64(recv) / float64(len(c.p)-1),
+		MinRelayCnt:         minRecv,
+		MaxRelayCnt:         maxRecv,
+		BDMessagedMerged:    bdMerged,
+		BytesTransmitted:    transmitted,
+		EstimatedBytes:      estimated,
+		DMessagesMerged:     dMerged,
+		PayloadsMerged:      pMerged,
+		Malformed:           malformed,
+		Dropped:             dropped,
+		Retransmitted:       retransmitted,
+		Acks:                acks,
+		Partitioned:         partitioned,
+		Forged:              forged,
+		Requested:           requested,
+		DeliveredBeforeHeal: beforeHeal,
+		DeliveredAfterHeal:  afterHeal,
+		Delivered:           delivered,
+		Violations:          violations,
+		ScheduleSeed:        seed,
 	}
 }
 
+// Congestion returns the queues of all links since the last flush, the deepest first
+func (c *Controller) Congestion() []LinkCongestion {
+	c.pLock.Lock()
+	defer c.pLock.Unlock()
+
+	var res []LinkCongestion
+	for pid, p := range c.p {
+		for n, s := range p.p.QueueStats() {
+			res = append(res, LinkCongestion{From: pid, To: n, QueueStats: s})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].MaxDepth == res[j].MaxDepth {
+			return res[i].MeanDepth() > res[j].MeanDepth()
+		}
+
+		return res[i].MaxDepth > res[j].MaxDepth
+	})
+
+	return res
+}
+
 func (c *Controller) Close() {
 	close(c.stopCh)
 
+	if c.listener != nil {
+		_ = c.listener.Close()
+	}
+
+	// Processes of the address book that joined but are not part of the graph are released
+	for _, ch := range c.arrivals {
+		select {
+		case rc := <-ch:
+			_ = rc.conn.Close()
+		default:
+		}
+	}
+
 	for _, ch := range c.channels {
 		close(ch)
 	}
+
+	for _, p := range c.p {
+		if r, ok := p.p.(*remoteProcess); ok {
+			r.wait()
+		}
+	}
 }
 
 func (c *Controller) send(id uint64, t uint8, b interface{}) {
-	c.channels[id] <- process.Message{
+	m := process.Message{
 		Ctl:  true,
 		Type: t,
 		Data: b,
 	}
+
+	// Messages are injected directly, so all messages sent at the same time are handled at the same virtual time
+	if c.sim != nil {
+		c.sim.Inject(id, m)
+		return
+	}
+
+	c.channels[id] <- m
+}
+
+// now returns the virtual time when simulated
+func (c *Controller) now() time.Time {
+	if c.sim != nil {
+		return c.sim.Now()
+	}
+
+	return time.Now()
 }
 
 func (c *Controller) run() {
@@ -442,11 +993,31 @@ func (c *Controller) handleMsg(src uint64, t uint8, b interface{}) {
 		//	return
 		//}
 
+		c.pLock.Lock()
+		byz, byzSource := c.p[src].byz, c.p[c.originMap[r.Id]].byz
+		c.pLock.Unlock()
+
+		// Byzantine processes can deliver anything
+		if byz {
+			return
+		}
+
 		c.dLock.Lock()
-		if !reflect.DeepEqual(r.Payload, c.payloadMap[r.Id]) {
-			fmt.Printf("process %v delived invalid payload, BRB guarantees violated: got %v, wanted %v\n",
-				src, r.Payload, c.payloadMap[r.Id])
-			os.Exit(1)
+		if _, ok := c.deliverMap[r.Id]; !ok {
+			c.violate(r.Id, Violation{Type: ValidityViolation, Process: src, Got: r.Payload})
+			c.dLock.Unlock()
+			return
+		}
+
+		if agreed, ok := c.agreedMap[r.Id]; !ok {
+			c.agreedMap[r.Id] = r.Payload
+		} else if !reflect.DeepEqual(r.Payload, agreed) {
+			c.violate(r.Id, Violation{Type: AgreementViolation, Process: src, Got: r.Payload, Wanted: agreed})
+		}
+
+		// The payload of a Byzantine source is not known
+		if !byzSource && !reflect.DeepEqual(r.Payload, c.payloadMap[r.Id]) {
+			c.violate(r.Id, Violation{Type: ValidityViolation, Process: src, Got: r.Payload, Wanted: c.payloadMap[r.Id]})
 		}
 
 		c.deliverMap[r.Id][src] = struct{}{}
@@ -460,3 +1031,10 @@ func (c *Controller) handleMsg(src uint64, t uint8, b interface{}) {
 		c.pLock.Unlock()
 	}
 }
+
+// Must be called while holding dLock
+func (c *Controller) violate(uid uint32, v Violation) {
+	c.violations[uid] = append(c.violations[uid], v)
+	fmt.Printf("process %v delivered %v, BRB guarantees violated (%v): got %v, wanted %v\n",
+		v.Process, uid, v.Type, v.Got, v.Wanted)
+}
@@ -0,0 +1,205 @@
+package ctrl
+
+import (
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/graph/simple"
+	"math/rand"
+	"rp-runner/graphs"
+	"sort"
+)
+
+// Placement ranks all nodes of the graph, the first nodes that are allowed to be Byzantine are picked as Byzantine
+// nodes. Sources are the possible transmitters of broadcasts.
+type Placement func(g *simple.WeightedUndirectedGraph, sources []uint64, cfg Config) ([]uint64, error)
+
+// Placements contains all Byzantine placement strategies by name, these names are also used by the CLI
+var Placements = map[string]Placement{
+	"first":       firstPlacement,
+	"random":      randomPlacement,
+	"degree":      degreePlacement,
+	"betweenness": betweennessPlacement,
+	"cut":         cutPlacement,
+	"nearest":     nearestPlacement,
+	"explicit":    explicitPlacement,
+}
+
+// sourcePlacements rank the nodes relative to the sources, so the possible transmitters are picked before placing
+var sourcePlacements = map[string]struct{}{
+	"nearest": {},
+}
+
+func placementUsesSources(name string) bool {
+	_, ok := sourcePlacements[name]
+	return ok
+}
+
+// PlacementNames returns the (sorted) names of all available Byzantine placement strategies
+func PlacementNames() []string {
+	res := make([]string, 0, len(Placements))
+	for name := range Placements {
+		res = append(res, name)
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+func sortedNodes(g *simple.WeightedUndirectedGraph) []uint64 {
+	nodes, _ := graphs.Nodes(g)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i] < nodes[j]
+	})
+
+	return nodes
+}
+
+// rank sorts the nodes by descending score, ties are broken by id
+func rank(nodes []uint64, score func(uint64) float64) []uint64 {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return score(nodes[i]) > score(nodes[j])
+	})
+
+	return nodes
+}
+
+// firstPlacement uses the iteration order of the graph, which is random, so the order only depends on the seed
+func firstPlacement(g *simple.WeightedUndirectedGraph, _ []uint64, cfg Config) ([]uint64, error) {
+	nodes := sortedNodes(g)
+	rand.New(rand.NewSource(cfg.Seed)).Shuffle(len(nodes), func(i, j int) {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	})
+
+	return nodes, nil
+}
+
+func randomPlacement(g *simple.WeightedUndirectedGraph, _ []uint64, cfg Config) ([]uint64, error) {
+	seed := cfg.PlacementSeed
+	if seed == 0 {
+		seed = cfg.Seed
+	}
+
+	nodes := sortedNodes(g)
+	rand.New(rand.NewSource(seed)).Shuffle(len(nodes), func(i, j int) {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	})
+
+	return nodes, nil
+}
+
+func degreePlacement(g *simple.WeightedUndirectedGraph, _ []uint64, _ Config) ([]uint64, error) {
+	return rank(sortedNodes(g), func(n uint64) float64 {
+		return float64(g.From(int64(n)).Len())
+	}), nil
+}
+
+func betweennessPlacement(g *simple.WeightedUndirectedGraph, _ []uint64, _ Config) ([]uint64, error) {
+	b := graphs.Betweenness(g)
+
+	return rank(sortedNodes(g), func(n uint64) float64 {
+		return b[n]
+	}), nil
+}
+
+// cutPlacement prefers the nodes of a minimum vertex cut, remaining nodes are ranked by degree
+func cutPlacement(g *simple.WeightedUndirectedGraph, _ []uint64, _ Config) ([]uint64, error) {
+	cut := make(map[uint64]struct{})
+	for _, n := range graphs.MinimumVertexCut(g) {
+		cut[n] = struct{}{}
+	}
+
+	return rank(sortedNodes(g), func(n uint64) float64 {
+		score := float64(g.From(int64(n)).Len())
+		if _, ok := cut[n]; ok {
+			score += float64(g.Nodes().Len())
+		}
+
+		return score
+	}), nil
+}
+
+// nearestPlacement prefers the nodes with the smallest amount of hops to any of the sources
+func nearestPlacement(g *simple.WeightedUndirectedGraph, sources []uint64, _ Config) ([]uint64, error) {
+	dist := make(map[uint64]int, g.Nodes().Len())
+	queue := make([]uint64, 0, g.Nodes().Len())
+
+	for _, s := range sources {
+		dist[s] = 0
+		queue = append(queue, s)
+	}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		to := g.From(int64(n))
+		for to.Next() {
+			if m := uint64(to.Node().ID()); !visited(dist, m) {
+				dist[m] = dist[n] + 1
+				queue = append(queue, m)
+			}
+		}
+	}
+
+	return rank(sortedNodes(g), func(n uint64) float64 {
+		if d, ok := dist[n]; ok {
+			return -float64(d)
+		}
+
+		return -float64(g.Nodes().Len())
+	}), nil
+}
+
+func explicitPlacement(g *simple.WeightedUndirectedGraph, _ []uint64, cfg Config) ([]uint64, error) {
+	for _, n := range cfg.ByzantineNodes {
+		if g.Node(int64(n)) == nil {
+			return nil, errors.Errorf("byzantine node %v does not exist", n)
+		}
+	}
+
+	return cfg.ByzantineNodes, nil
+}
+
+func visited(dist map[uint64]int, n uint64) bool {
+	_, ok := dist[n]
+	return ok
+}
+
+// placeByzantine picks the Byzantine nodes (excluding the nodes in exclude) using the configured strategy
+func (c *Controller) placeByzantine(g *simple.WeightedUndirectedGraph, sources []uint64, exclude map[uint64]struct{}, amount int) ([]uint64, error) {
+	name := c.cfg.Placement
+	if name == "" {
+		name = "first"
+	}
+
+	place, ok := Placements[name]
+	if !ok {
+		return nil, errors.Errorf("unknown byzantine placement: %v", name)
+	}
+
+	ranking, err := place(g, sources, c.cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to place byzantine nodes (%v)", name)
+	}
+
+	res := make([]uint64, 0, amount)
+	picked := make(map[uint64]struct{}, amount)
+	for _, n := range ranking {
+		if len(res) == amount {
+			break
+		}
+
+		_, excluded := exclude[n]
+		if _, ok := picked[n]; ok || excluded {
+			continue
+		}
+
+		picked[n] = struct{}{}
+		res = append(res, n)
+	}
+
+	if len(res) < amount {
+		return nil, errors.Errorf("placement %v only found %v of %v byzantine nodes", name, len(res), amount)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,635 @@
+package ctrl
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"rp-runner/brb"
+	"rp-runner/graphs"
+	"rp-runner/msg"
+	"rp-runner/process"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// connectNotice is how long the controller waits for a process of the address book before telling it is waiting
+const connectNotice = 3 * time.Second
+
+func init() {
+	gob.Register(msg.RunnerStatus{})
+	gob.Register(msg.TriggerMessage{})
+	gob.Register(msg.MessageDelivered{})
+	gob.Register(msg.CorruptMessage{})
+	gob.Register(process.UniformLinks{})
+	gob.Register(process.SpreadLinks{})
+	gob.Register(process.LinkProfile{})
+}
+
+// Transport determines how processes are connected
+type Transport int
+
+const (
+	// All processes run in the OS process of the controller and are connected using channels
+	ChannelTransport Transport = iota
+	// Every process runs in its own OS process, processes are connected over localhost TCP
+	TCPTransport
+)
+
+type remoteKind uint8
+
+// A process in a child OS process receives a setup and replies with a hello containing its address, after which the
+// controller sends the addresses of its peers. Processes of an address book first join using their id.
+const (
+	joinKind remoteKind = iota
+	setupKind
+	helloKind
+	peersKind
+	messageKind
+	statsKind
+	flushKind
+	stopFlushKind
+)
+
+// remoteSetup contains everything a process in a child OS process needs to create its protocol. It is sent in
+// cleartext, including the link keys and the signing key of the process, and anyone that can reach the controller of an
+// address book can join as a process. The authentication of links and signatures therefore only holds on a trusted
+// network.
+type remoteSetup struct {
+	Id                    uint64
+	Protocol, Adversary   string
+	AdversaryDelay        time.Duration
+	Byz, Silent, Unused   bool
+	N, F                  int
+	Neighbours, Byzantine []uint64
+	Optimizations         brb.OptimizationConfig
+	Graph                 []byte
+	Buffer                int
+
+	MaxRetries                 int
+	RetryDelay, NeighbourDelay time.Duration
+	Links                      process.LinkModel
+	Reliable                   bool
+	RetransmitTimeout          time.Duration
+	QueueSize                  int
+	Overflow                   process.OverflowPolicy
+	SpillDir                   string
+	Seed                       int64
+	Keys                       map[uint64][]byte
+	Signing                    brb.SignatureKeys
+}
+
+// remoteMessage is sent between the controller and a process in a child OS process, which one of the fields is used
+// depends on the kind
+type remoteMessage struct {
+	Kind   remoteKind
+	Id     uint64
+	Setup  *remoteSetup
+	Addr   string
+	Peers  map[uint64]string
+	Msg    process.Message
+	Stats  process.Stats
+	Queues map[uint64]process.QueueStats
+}
+
+// remoteConn is the control connection of a process that joined the controller
+type remoteConn struct {
+	conn net.Conn
+	dec  *gob.Decoder
+}
+
+// remoteProcess is a process running in another OS process, which is controlled using a pipe in both directions or
+// using a connection to the controller. The OS process is only known if it was started by the controller.
+type remoteProcess struct {
+	id         uint64
+	neighbours []uint64
+	book       map[uint64]string
+	done       chan struct{}
+
+	in   io.WriteCloser
+	enc  *gob.Encoder
+	lock sync.Mutex
+
+	stats     chan remoteMessage
+	statsLock sync.Mutex
+	stopCh    <-chan struct{}
+}
+
+// command creates the command to start a process in a child OS process, using the same executable as the controller
+func command(args ...string) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to find executable")
+	}
+
+	cmd := exec.Command(exe, append([]string{"process"}, args...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+	return cmd, nil
+}
+
+// start starts a command, the returned channel is closed once it exits
+func start(cmd *exec.Cmd) (chan struct{}, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "unable to start child process")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+
+	return done, nil
+}
+
+// accept accepts the control connections of the processes in the address book
+func (c *Controller) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			dec := gob.NewDecoder(conn)
+
+			var join remoteMessage
+			if err := dec.Decode(&join); err != nil || join.Kind != joinKind {
+				_ = conn.Close()
+				return
+			}
+
+			ch, ok := c.arrivals[join.Id]
+			if !ok {
+				fmt.Printf("process %v is not in the address book\n", join.Id)
+				_ = conn.Close()
+				return
+			}
+
+			select {
+			case ch <- remoteConn{conn: conn, dec: dec}:
+			default:
+				fmt.Printf("process %v joined twice\n", join.Id)
+				_ = conn.Close()
+			}
+		}()
+	}
+}
+
+// connect waits until process id of the address book joins, processes on a loopback address are started first. The
+// returned channel is closed once a started process exits, it is nil for processes started elsewhere.
+func (c *Controller) connect(id uint64) (remoteConn, chan struct{}, error) {
+	book := c.cfg.AddressBook
+	ch, ok := c.arrivals[id]
+	if !ok {
+		return remoteConn{}, nil, errors.Errorf("process %v is not in the address book", id)
+	}
+
+	var done chan struct{}
+	if book.Local(id) {
+		cmd, err := command("--book", book.Path, "--id", strconv.FormatUint(id, 10))
+		if err != nil {
+			return remoteConn{}, nil, err
+		}
+
+		if done, err = start(cmd); err != nil {
+			return remoteConn{}, nil, err
+		}
+	}
+
+	notice := time.After(connectNotice)
+	for {
+		select {
+		case rc := <-ch:
+			return rc, done, nil
+		case <-done:
+			return remoteConn{}, nil, errors.Errorf("process %v exited before joining", id)
+		case <-notice:
+			fmt.Printf("waiting for process %v (%v) to join\n", id, book.Processes[id])
+		}
+	}
+}
+
+// startRemote starts a process in another OS process, which listens for its neighbours on a random port of localhost
+// or on its address in the address book
+func (c *Controller) startRemote(cfg process.Config, bp brb.Protocol, byzantine []uint64) error {
+	g, err := graphs.Encode(cfg.ByzConfig.Graph)
+	if err != nil {
+		return err
+	}
+
+	bc := cfg.ByzConfig
+	setup := remoteSetup{
+		Id:                bc.Id,
+		Protocol:          brb.ProtocolName(bp),
+		Adversary:         c.cfg.Adversary,
+		AdversaryDelay:    c.cfg.AdversaryDelay,
+		Byz:               bc.Byz,
+		Silent:            bc.Silent,
+		Unused:            bc.Unused,
+		N:                 bc.N,
+		F:                 bc.F,
+		Neighbours:        bc.Neighbours,
+		Byzantine:         byzantine,
+		Optimizations:     bc.OptimizationConfig,
+		Signing:           bc.Signing,
+		Graph:             g,
+		Buffer:            c.cfg.ProcBuffer,
+		MaxRetries:        cfg.MaxRetries,
+		RetryDelay:        cfg.RetryDelay,
+		NeighbourDelay:    cfg.NeighbourDelay,
+		Links:             c.cfg.Links,
+		Reliable:          cfg.Reliable,
+		RetransmitTimeout: cfg.RetransmitTimeout,
+		QueueSize:         cfg.QueueSize,
+		Overflow:          cfg.Overflow,
+		SpillDir:          cfg.SpillDir,
+		Seed:              cfg.Seed,
+		Keys:              cfg.Keys,
+	}
+
+	var in io.WriteCloser
+	var dec *gob.Decoder
+	var done chan struct{}
+	if c.cfg.AddressBook != nil {
+		rc, d, err := c.connect(bc.Id)
+		if err != nil {
+			return err
+		}
+		in, dec, done = rc.conn, rc.dec, d
+	} else {
+		// The child reads commands from file descriptor 3 and writes to 4, so it can still print to stdout
+		inR, inW, err := os.Pipe()
+		if err != nil {
+			return errors.Wrap(err, "unable to create pipe")
+		}
+		outR, outW, err := os.Pipe()
+		if err != nil {
+			return errors.Wrap(err, "unable to create pipe")
+		}
+
+		cmd, err := command()
+		if err != nil {
+			return err
+		}
+
+		cmd.ExtraFiles = []*os.File{inR, outW}
+		if done, err = start(cmd); err != nil {
+			return err
+		}
+		_ = inR.Close()
+		_ = outW.Close()
+
+		in, dec = inW, gob.NewDecoder(outR)
+	}
+
+	r := &remoteProcess{
+		id:         bc.Id,
+		neighbours: bc.Neighbours,
+		book:       c.book,
+		done:       done,
+		in:         in,
+		enc:        gob.NewEncoder(in),
+		stats:      make(chan remoteMessage),
+		stopCh:     c.stopCh,
+	}
+
+	var hello remoteMessage
+	if err := r.encode(remoteMessage{Kind: setupKind, Setup: &setup}); err != nil {
+		_ = in.Close()
+		return err
+	} else if err := dec.Decode(&hello); err != nil {
+		_ = in.Close()
+		return errors.Wrapf(err, "no response from process %v", bc.Id)
+	}
+
+	ch := make(chan process.Message, c.cfg.ProcBuffer)
+
+	c.pLock.Lock()
+	c.book[bc.Id] = hello.Addr
+	c.p[bc.Id] = proc{p: r, byz: bc.Byz}
+	c.channels[bc.Id] = ch
+	c.pLock.Unlock()
+
+	go r.read(dec, c.ctl)
+	go r.forward(ch)
+
+	return nil
+}
+
+func (r *remoteProcess) encode(m remoteMessage) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return errors.Wrapf(r.enc.Encode(m), "unable to send command to process %v", r.id)
+}
+
+func (r *remoteProcess) read(dec *gob.Decoder, ctl chan process.Message) {
+	defer close(r.stats)
+
+	for {
+		var m remoteMessage
+		if err := dec.Decode(&m); err != nil {
+			select {
+			case <-r.stopCh:
+				return
+			default:
+			}
+
+			fmt.Printf("process %v exited unexpectedly: %v\n", r.id, err)
+			os.Exit(1)
+		}
+
+		switch m.Kind {
+		case messageKind:
+			select {
+			case ctl <- m.Msg:
+			case <-r.stopCh:
+				return
+			}
+		case statsKind:
+			r.stats <- m
+		}
+	}
+}
+
+// forward sends all messages of the controller to the process, the process stops once the channel is closed
+func (r *remoteProcess) forward(ch chan process.Message) {
+	for m := range ch {
+		// Adversaries can not be sent to other OS processes, the process creates its own adversary instead
+		if m.Type == msg.CorruptType {
+			m.Data = msg.CorruptMessage{}
+		}
+
+		if err := r.encode(remoteMessage{Kind: messageKind, Msg: m}); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+
+	_ = r.in.Close()
+}
+
+// wait waits until the OS process exits, if it was started by the controller
+func (r *remoteProcess) wait() {
+	if r.done != nil {
+		<-r.done
+	}
+}
+
+func (r *remoteProcess) Start(map[uint64]chan process.Message) error {
+	peers := make(map[uint64]string, len(r.neighbours))
+	for _, n := range r.neighbours {
+		peers[n] = r.book[n]
+	}
+
+	return r.encode(remoteMessage{Kind: peersKind, Peers: peers})
+}
+
+// request returns the statistics of the process, which are empty if the process stopped
+func (r *remoteProcess) request() remoteMessage {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+
+	if err := r.encode(remoteMessage{Kind: statsKind}); err != nil {
+		return remoteMessage{}
+	}
+
+	return <-r.stats
+}
+
+func (r *remoteProcess) Stats() process.Stats {
+	return r.request().Stats
+}
+
+func (r *remoteProcess) QueueStats() map[uint64]process.QueueStats {
+	return r.request().Queues
+}
+
+func (r *remoteProcess) Flush() {
+	_ = r.encode(remoteMessage{Kind: flushKind})
+}
+
+func (r *remoteProcess) StopFlush() {
+	_ = r.encode(remoteMessage{Kind: stopFlushKind})
+}
+
+// RunRemoteProcess runs a single process that was started by a controller using the TCP transport, commands of the
+// controller are read from in and messages to the controller are written to out. It returns once the controller
+// closes in.
+func RunRemoteProcess(in io.Reader, out io.Writer) error {
+	return runRemote(gob.NewDecoder(in), gob.NewEncoder(out), "127.0.0.1:0")
+}
+
+// RunBookProcess runs process id of the address book, which joins the controller of the address book. Joining is
+// retried until timeout, so processes can be started before the controller. It returns once the test has finished, or
+// if serve is set, once the controller of a next test can not be reached within timeout.
+func RunBookProcess(book *AddressBook, id uint64, timeout time.Duration, serve bool) error {
+	addr, ok := book.Processes[id]
+	if !ok {
+		return errors.Errorf("process %v is not in the address book", id)
+	}
+
+	for served := 0; ; served++ {
+		conn, err := dialController(book.Controller, timeout)
+		if err != nil && serve && served > 0 {
+			fmt.Printf("process %v served %v tests, no next test: %v\n", id, served, err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = joinController(conn, id, addr)
+		if err != nil || !serve {
+			return err
+		}
+	}
+}
+
+// dialController connects to the controller, retrying until timeout
+func dialController(controller string, timeout time.Duration) (net.Conn, error) {
+	start := time.Now()
+	conn, err := net.Dial("tcp", controller)
+	for err != nil {
+		if time.Since(start) > timeout {
+			return nil, errors.Wrapf(err, "unable to reach controller at %v", controller)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+		conn, err = net.Dial("tcp", controller)
+	}
+
+	return conn, nil
+}
+
+// joinController runs process id for the test of the controller connected to conn
+func joinController(conn net.Conn, id uint64, addr string) error {
+	defer conn.Close()
+
+	enc := gob.NewEncoder(conn)
+	if err := enc.Encode(remoteMessage{Kind: joinKind, Id: id}); err != nil {
+		return errors.Wrap(err, "unable to join controller")
+	}
+
+	return runRemote(gob.NewDecoder(conn), enc, addr)
+}
+
+// runRemote runs a single process, which listens for its neighbours on addr
+func runRemote(dec *gob.Decoder, enc *gob.Encoder, addr string) error {
+	var lock sync.Mutex
+
+	reply := func(m remoteMessage) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if err := enc.Encode(m); err != nil {
+			fmt.Printf("process is unable to reach controller: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var m remoteMessage
+	if err := dec.Decode(&m); err != nil {
+		return errors.Wrap(err, "no setup from controller")
+	} else if m.Setup == nil {
+		return errors.New("first message of controller is not a setup")
+	}
+	s := m.Setup
+
+	stopCh := make(chan struct{})
+	endpoint, err := process.ListenTCP(s.Id, addr, s.Buffer, stopCh)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		close(stopCh)
+		endpoint.Close()
+	}()
+
+	reply(remoteMessage{Kind: helloKind, Addr: endpoint.Addr()})
+
+	g, err := graphs.Decode(s.Graph)
+	if err != nil {
+		return err
+	}
+
+	bp, err := brb.NewProtocol(s.Protocol)
+	if err != nil {
+		return err
+	}
+
+	fullTable, err := fullRoutingTable(g, s.Optimizations, s.N, s.F, bp)
+	if err != nil {
+		return err
+	}
+
+	// Colluding adversaries only share a coordinator with the adversary of a later corruption of this process
+	coordinator := brb.NewCoordinator(g, s.F, s.Byzantine)
+	adversary := func() (brb.Adversary, error) {
+		adv, err := newAdversary(s.Adversary, s.AdversaryDelay)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create adversary")
+		}
+
+		if col, ok := adv.(brb.Colluding); ok {
+			col.Join(coordinator)
+		}
+
+		return adv, nil
+	}
+
+	if s.Byz {
+		adv, err := adversary()
+		if err != nil {
+			return err
+		}
+		bp = &brb.Byzantine{Honest: bp, Adv: adv}
+	} else {
+		bp = &brb.Corruptible{Honest: bp}
+	}
+
+	cfg := process.Config{
+		MaxRetries:        s.MaxRetries,
+		RetryDelay:        s.RetryDelay,
+		NeighbourDelay:    s.NeighbourDelay,
+		Links:             s.Links,
+		Reliable:          s.Reliable,
+		RetransmitTimeout: s.RetransmitTimeout,
+		QueueSize:         s.QueueSize,
+		Overflow:          s.Overflow,
+		SpillDir:          s.SpillDir,
+		Seed:              s.Seed,
+		Keys:              s.Keys,
+		ByzConfig: brb.Config{
+			Byz:                s.Byz,
+			N:                  s.N,
+			F:                  s.F,
+			Id:                 s.Id,
+			Neighbours:         s.Neighbours,
+			Graph:              g,
+			Silent:             s.Silent,
+			Unused:             s.Unused,
+			OptimizationConfig: s.Optimizations,
+			Precomputed:        brb.PrecomputedValues{FullTable: fullTable},
+			Signing:            s.Signing,
+		},
+	}
+
+	ctl := make(chan process.Message, s.Buffer)
+	go func() {
+		for {
+			select {
+			case m := <-ctl:
+				reply(remoteMessage{Kind: messageKind, Msg: m})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	p, err := process.StartProcess(s.Id, cfg, stopCh, s.Neighbours, bp, ctl)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var m remoteMessage
+		if err := dec.Decode(&m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "lost connection to controller")
+		}
+
+		switch m.Kind {
+		case peersKind:
+			channels, err := endpoint.Connect(m.Peers)
+			if err != nil {
+				return err
+			}
+
+			if err := p.Start(channels); err != nil {
+				return errors.Wrap(err, "failed to start process")
+			}
+		case messageKind:
+			if m.Msg.Type == msg.CorruptType {
+				adv, err := adversary()
+				if err != nil {
+					return err
+				}
+				m.Msg.Data = msg.CorruptMessage{Adversary: adv}
+			}
+
+			endpoint.Inbox() <- m.Msg
+		case statsKind:
+			reply(remoteMessage{Kind: statsKind, Stats: p.Stats(), Queues: p.QueueStats()})
+		case flushKind:
+			p.Flush()
+		case stopFlushKind:
+			p.StopFlush()
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package ctrl
 
-import "time"
+import (
+	"rp-runner/process"
+	"time"
+)
 
 type Stats struct {
 	Latency                            time.Duration
@@ -11,4 +14,74 @@ type Stats struct {
 	BytesTransmitted                   int
 	DMessagesMerged                    int
 	PayloadsMerged                     int
+
+	// BytesTransmitted is the size of the encoded messages, the estimated size (as used by the paper) is kept for
+	// comparison
+	EstimatedBytes int
+
+	// Amount of messages dropped because they were malformed
+	Malformed int
+
+	// Amount of messages lost by the links, and the cost of the reliable link layer
+	Dropped, Retransmitted, Acks int
+
+	// Amount of messages queued or dropped by partitions, and deliveries by correct processes before and after the
+	// last partition healed
+	Partitioned                             int
+	DeliveredBeforeHeal, DeliveredAfterHeal int
+
+	// Amount of messages rejected because their MAC did not match the link they claimed to be sent over
+	Forged int
+
+	// Amount of payloads requested by processes that only received digests (orb3)
+	Requested int
+
+	// Amount of correct processes that delivered, and all violations of the BRB guarantees that were detected
+	Delivered  int
+	Violations []Violation
+
+	// Whether correct processes did not deliver even though no messages were left, and the seed of the schedule used
+	// when simulating with an adversarial scheduler
+	Stuck        bool
+	ScheduleSeed int64
+}
+
+type ViolationType int
+
+const (
+	// Two correct processes delivered different payloads
+	AgreementViolation ViolationType = iota
+	// A correct process delivered a payload that was not broadcast by the (correct) source
+	ValidityViolation
+)
+
+func (v ViolationType) String() string {
+	switch v {
+	case AgreementViolation:
+		return "agreement"
+	case ValidityViolation:
+		return "validity"
+	default:
+		return "unknown"
+	}
+}
+
+type Violation struct {
+	Type        ViolationType
+	Process     uint64
+	Got, Wanted interface{}
+}
+
+// LinkCongestion describes the outbound queue of the link from From to To
+type LinkCongestion struct {
+	From, To uint64
+	process.QueueStats
+}
+
+func (l LinkCongestion) MeanDepth() float64 {
+	if l.Queued == 0 {
+		return 0
+	}
+
+	return float64(l.TotalDepth) / float64(l.Queued)
 }
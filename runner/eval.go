@@ -26,7 +26,7 @@ func brachaDolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, c
 	_, name := gen.Cache()
 	runCfg.K = 50
 	runCfg.F = 24
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -36,7 +36,7 @@ func brachaDolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, c
 	_, name = gen.Cache()
 	runCfg.K = 50
 	runCfg.F = 10
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -46,7 +46,7 @@ func brachaDolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, c
 	_, name = gen.Cache()
 	runCfg.K = 24
 	runCfg.F = 11
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -56,7 +56,7 @@ func brachaDolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, c
 	_, name = gen.Cache()
 	runCfg.K = 24
 	runCfg.F = 5
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -66,7 +66,7 @@ func brachaDolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, c
 	_, name = gen.Cache()
 	runCfg.K = 10
 	runCfg.F = 4
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -76,7 +76,7 @@ func brachaDolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, c
 	_, name = gen.Cache()
 	runCfg.K = 10
 	runCfg.F = 2
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -101,7 +101,7 @@ func brachaDolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name := gen.Cache()
 	runCfg.K = 60
 	runCfg.F = 24
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -111,7 +111,7 @@ func brachaDolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 50
 	runCfg.F = 24
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -121,7 +121,7 @@ func brachaDolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 40
 	runCfg.F = 19
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -131,7 +131,7 @@ func brachaDolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 30
 	runCfg.F = 14
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -141,7 +141,7 @@ func brachaDolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 20
 	runCfg.F = 9
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -151,7 +151,7 @@ func brachaDolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 10
 	runCfg.F = 4
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -176,7 +176,7 @@ func brachaDolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pr
 	runCfg.N = 75
 	runCfg.K = 24
 	runCfg.F = 11
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -187,7 +187,7 @@ func brachaDolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pr
 	runCfg.N = 50
 	runCfg.K = 16
 	runCfg.F = 7
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -198,7 +198,7 @@ func brachaDolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pr
 	runCfg.N = 25
 	runCfg.K = 8
 	runCfg.F = 3
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -223,7 +223,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name := gen.Cache()
 	runCfg.K = 100
 	runCfg.F = 48
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -233,7 +233,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 100
 	runCfg.F = 20
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -243,7 +243,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 75
 	runCfg.F = 36
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -253,7 +253,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 75
 	runCfg.F = 15
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -263,7 +263,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 50
 	runCfg.F = 24
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -273,7 +273,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 50
 	runCfg.F = 10
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -283,7 +283,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 25
 	runCfg.F = 12
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -293,7 +293,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 25
 	runCfg.F = 5
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -303,7 +303,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 10
 	runCfg.F = 4
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -313,7 +313,7 @@ func dolevIndividualTests(opts brb.OptimizationConfig, info ctrl.Config, cfg pro
 	_, name = gen.Cache()
 	runCfg.K = 10
 	runCfg.F = 2
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -338,7 +338,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name := gen.Cache()
 	runCfg.K = 100
 	runCfg.F = 49
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -348,7 +348,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 90
 	runCfg.F = 44
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -358,7 +358,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 80
 	runCfg.F = 39
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -368,7 +368,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 70
 	runCfg.F = 34
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -378,7 +378,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 60
 	runCfg.F = 29
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -388,7 +388,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 50
 	runCfg.F = 24
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -398,7 +398,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 40
 	runCfg.F = 19
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -408,7 +408,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 30
 	runCfg.F = 14
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -418,7 +418,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 20
 	runCfg.F = 9
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -428,7 +428,7 @@ func dolevFullTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.C
 	_, name = gen.Cache()
 	runCfg.K = 10
 	runCfg.F = 4
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -453,7 +453,7 @@ func dolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.
 	runCfg.N = 150
 	runCfg.K = 50
 	runCfg.F = 24
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -464,7 +464,7 @@ func dolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.
 	runCfg.N = 125
 	runCfg.K = 40
 	runCfg.F = 19
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -475,7 +475,7 @@ func dolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.
 	runCfg.N = 100
 	runCfg.K = 33
 	runCfg.F = 16
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -486,7 +486,7 @@ func dolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.
 	runCfg.N = 75
 	runCfg.K = 24
 	runCfg.F = 11
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -497,7 +497,7 @@ func dolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.
 	runCfg.N = 50
 	runCfg.K = 16
 	runCfg.F = 7
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -508,7 +508,7 @@ func dolevScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.
 	runCfg.N = 25
 	runCfg.K = 8
 	runCfg.F = 3
-	runCfg.Generator = graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
+	runCfg.Generator = &graphs.FileCacheGenerator{Name: fmt.Sprintf("generated/%v-%v-%v.graph", name, runCfg.N, runCfg.K), Gen: gen}
 	if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
 		fmt.Printf("err while running simple test: %v\n", err)
 		os.Exit(1)
@@ -721,3 +721,31 @@ func brachaScaleTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process
 	}
 	skip--
 }
+
+// payloadSweepTests compares the protocols for fully connected networks with increasing payload sizes, to find the
+// payload size from which erasure coding is beneficial
+func payloadSweepTests(opts brb.OptimizationConfig, info ctrl.Config, cfg process.Config, runs int, multiple bool, skip int) {
+	runCfg := RunConfig{
+		Runs:                 runs,
+		N:                    25,
+		F:                    8,
+		Degree:               -1,
+		MultipleTransmitters: multiple,
+		Generator:            &graphs.FullyConnectedGenerator{},
+		ControlCfg:           info,
+		ProcessCfg:           cfg,
+		OptimizationCfg:      opts,
+	}
+
+	for _, size := range []int{12, 100, 1000, 10000, 100000, 1000000} {
+		for _, p := range []brb.Protocol{&brb.BrachaImproved{}, &brb.SignedEcho{}, &brb.Avid{}} {
+			runCfg.PayloadSize = size
+			runCfg.Protocol = p
+			if err := runMultipleMessagesTest(runCfg, skip > 0); err != nil {
+				fmt.Printf("err while running simple test: %v\n", err)
+				os.Exit(1)
+			}
+			skip--
+		}
+	}
+}
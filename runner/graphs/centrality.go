@@ -0,0 +1,52 @@
+package graphs
+
+import "gonum.org/v1/gonum/graph/simple"
+
+// Betweenness computes the (unweighted) betweenness centrality of all nodes, using Brandes' algorithm
+func Betweenness(g *simple.WeightedUndirectedGraph) map[uint64]float64 {
+	nodes, _ := Nodes(g)
+	res := make(map[uint64]float64, len(nodes))
+
+	for _, s := range nodes {
+		stack := make([]uint64, 0, len(nodes))
+		pred := make(map[uint64][]uint64, len(nodes))
+		sigma := map[uint64]float64{s: 1}
+		dist := map[uint64]int{s: 0}
+		queue := []uint64{s}
+
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+
+			to := g.From(int64(v))
+			for to.Next() {
+				w := uint64(to.Node().ID())
+
+				if _, ok := dist[w]; !ok {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					pred[w] = append(pred[w], v)
+				}
+			}
+		}
+
+		delta := make(map[uint64]float64, len(nodes))
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range pred[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+
+			if w != s {
+				res[w] += delta[w]
+			}
+		}
+	}
+
+	return res
+}
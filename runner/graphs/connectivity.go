@@ -4,6 +4,7 @@ import (
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/simple"
 	"math"
+	"sort"
 )
 
 type pair struct {
@@ -105,3 +106,111 @@ func FindConnectedness(gu *simple.WeightedUndirectedGraph) int {
 
 	return minV
 }
+
+// MinimumVertexCut finds a minimum set of nodes whose removal disconnects the graph, using the same pairs as
+// FindConnectedness. Returns nil for fully connected graphs, as those have no vertex cut.
+func MinimumVertexCut(gu *simple.WeightedUndirectedGraph) []uint64 {
+	nodes, max := Nodes(gu)
+	if len(nodes) < 2 {
+		return nil
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i] < nodes[j]
+	})
+
+	// Split every node in an in (id) and out (id+size) node, only the in -> out edges have a capacity of 1
+	size := max + 1
+	edges := make(AdjacencyMap, 2*size)
+	for i := range edges {
+		edges[i] = make([]graph.WeightedEdge, 2*size)
+	}
+
+	set := func(from, to int64, w float64) {
+		edges[from][to] = simple.WeightedEdge{F: simple.Node(from), T: simple.Node(to), W: w}
+		if edges[to][from] == nil {
+			edges[to][from] = simple.WeightedEdge{F: simple.Node(to), T: simple.Node(from), W: 0}
+		}
+	}
+
+	minN, minV := int64(-1), math.MaxInt64
+	for _, n := range nodes {
+		id := int64(n)
+		set(id, id+size, 1)
+
+		to := gu.From(id)
+		if to.Len() < minV {
+			minN, minV = id, to.Len()
+		}
+
+		for to.Next() {
+			set(id+size, to.Node().ID(), float64(len(nodes)))
+		}
+	}
+
+	var best []uint64
+	try := func(s, t int64) {
+		duplicate := make(AdjacencyMap, len(edges))
+		for i := range edges {
+			duplicate[i] = make([]graph.WeightedEdge, len(edges[i]))
+			copy(duplicate[i], edges[i])
+		}
+
+		// s and t can not be part of the cut
+		duplicate[s][s+size] = simple.WeightedEdge{F: simple.Node(s), T: simple.Node(s + size), W: float64(len(nodes))}
+		duplicate[t][t+size] = simple.WeightedEdge{F: simple.Node(t), T: simple.Node(t + size), W: float64(len(nodes))}
+
+		if flow := maxFlow(duplicate, s+size, t); best != nil && flow >= len(best) {
+			return
+		}
+
+		// Nodes that are reachable in the residual graph, but can not be passed through are part of the cut
+		reachable := make([]bool, len(duplicate))
+		reachable[s+size] = true
+		queue := []int64{s + size}
+
+		for len(queue) > 0 {
+			n := queue[0]
+			queue = queue[1:]
+
+			for _, e := range duplicate[n] {
+				if e != nil && e.Weight() > 0 && !reachable[e.To().ID()] {
+					reachable[e.To().ID()] = true
+					queue = append(queue, e.To().ID())
+				}
+			}
+		}
+
+		cut := make([]uint64, 0)
+		for _, n := range nodes {
+			if reachable[n] && !reachable[int64(n)+size] {
+				cut = append(cut, n)
+			}
+		}
+
+		best = cut
+	}
+
+	neighbours := make([]int64, 0, minV)
+	for _, n := range nodes {
+		id := int64(n)
+		if id == minN {
+			continue
+		}
+
+		if gu.HasEdgeBetween(minN, id) {
+			neighbours = append(neighbours, id)
+			continue
+		}
+
+		try(minN, id)
+	}
+
+	for _, p := range findPairs(neighbours) {
+		if !gu.HasEdgeBetween(p.a, p.b) {
+			try(p.a, p.b)
+		}
+	}
+
+	return best
+}
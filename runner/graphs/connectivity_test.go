@@ -2,6 +2,7 @@ package graphs
 
 import (
 	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/graph/simple"
 	"testing"
 )
 
@@ -58,3 +59,35 @@ func TestFindConnectedness3Mul(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, k, FindConnectedness(g))
 }
+
+func TestMinimumVertexCut(t *testing.T) {
+	g := simple.NewWeightedUndirectedGraph(0, 0)
+
+	// Two triangles (0, 1, 2) and (4, 5, 6) only connected through node 3
+	for _, e := range [][2]int64{{0, 1}, {1, 2}, {0, 2}, {2, 3}, {3, 4}, {4, 5}, {5, 6}, {4, 6}} {
+		g.SetWeightedEdge(g.NewWeightedEdge(simple.Node(e[0]), simple.Node(e[1]), 1))
+	}
+
+	cut := MinimumVertexCut(g)
+	assert.Len(t, cut, 1)
+	assert.Contains(t, []uint64{2, 3, 4}, cut[0])
+
+	fc, err := FullyConnectedGenerator{}.Generate(5, 5, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, MinimumVertexCut(fc))
+}
+
+func TestBetweenness(t *testing.T) {
+	g := simple.NewWeightedUndirectedGraph(0, 0)
+
+	// Path 0 - 1 - 2 - 3
+	for i := int64(0); i < 3; i++ {
+		g.SetWeightedEdge(g.NewWeightedEdge(simple.Node(i), simple.Node(i+1), 1))
+	}
+
+	// Both directions are counted
+	b := Betweenness(g)
+	assert.Equal(t, 0.0, b[0])
+	assert.Equal(t, 4.0, b[1])
+	assert.Equal(t, 4.0, b[2])
+}
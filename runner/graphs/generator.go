@@ -6,7 +6,9 @@ import (
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/simple"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 type Generator interface {
@@ -16,6 +18,11 @@ type Generator interface {
 	Cache() (bool, string)
 }
 
+// Seeded generators are random, the graph they generate only depends on the seed
+type Seeded interface {
+	SetSeed(seed int64)
+}
+
 func node(g *simple.WeightedUndirectedGraph, id int) graph.Node {
 	n := g.Node(int64(id))
 
@@ -42,41 +49,63 @@ func (r BasicGenerator) Cache() (bool, string) {
 	return false, ""
 }
 
+// FileCacheGenerator stores the graphs of Gen in a file, graphs of seeded generators are stored for every seed
 type FileCacheGenerator struct {
 	Gen  Generator
 	Name string
+
+	seed   int64
+	seeded bool
+}
+
+// file returns the name of the file the graph is stored in
+func (fc *FileCacheGenerator) file() string {
+	if !fc.seeded {
+		return fc.Name
+	}
+
+	ext := filepath.Ext(fc.Name)
+	return fmt.Sprintf("%v-%v%v", strings.TrimSuffix(fc.Name, ext), fc.seed, ext)
 }
 
-func (fc FileCacheGenerator) dump(n, k, d int) (*simple.WeightedUndirectedGraph, error) {
+func (fc *FileCacheGenerator) dump(n, k, d int) (*simple.WeightedUndirectedGraph, error) {
 	g, err := fc.Gen.Generate(n, k, d)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate graph before caching in files")
 	}
 
 	if d, _ := fc.Gen.Cache(); d {
-		fmt.Printf("graph %v does not exist in storage, dumping the generated graph...\n", fc.Name)
+		fmt.Printf("graph %v does not exist in storage, dumping the generated graph...\n", fc.file())
 
-		if err := DumpToFile(g, fc.Name); err != nil {
+		if err := DumpToFile(g, fc.file()); err != nil {
 			return nil, errors.Wrap(err, "unable to save file")
 		}
 	} else {
-		fmt.Printf("graph %v is not marked as saveable, graph will not be saved and regenerated next time\n", fc.Name)
+		fmt.Printf("graph %v is not marked as saveable, graph will not be saved and regenerated next time\n", fc.file())
 	}
 
 	return g, nil
 }
 
-func (fc FileCacheGenerator) Generate(n, k, d int) (*simple.WeightedUndirectedGraph, error) {
-	if _, err := os.Stat(fc.Name); os.IsNotExist(err) {
+func (fc *FileCacheGenerator) Generate(n, k, d int) (*simple.WeightedUndirectedGraph, error) {
+	if _, err := os.Stat(fc.file()); os.IsNotExist(err) {
 		// Need to generate the graph first once
-		fmt.Printf("graph %v does not exist in storage, generating it first...\n", fc.Name)
+		fmt.Printf("graph %v does not exist in storage, generating it first...\n", fc.file())
 		return fc.dump(n, k, d)
 	}
 
-	fmt.Printf("graph %v exists in storage!\n", fc.Name)
-	return ReadFromFile(fc.Name)
+	fmt.Printf("graph %v exists in storage!\n", fc.file())
+	return ReadFromFile(fc.file())
 }
 
-func (fc FileCacheGenerator) Cache() (bool, string) {
+func (fc *FileCacheGenerator) Cache() (bool, string) {
 	return false, ""
 }
+
+// SetSeed seeds the generator, the graph of every seed is stored separately
+func (fc *FileCacheGenerator) SetSeed(seed int64) {
+	if s, ok := fc.Gen.(Seeded); ok {
+		s.SetSeed(seed)
+		fc.seed, fc.seeded = seed, true
+	}
+}
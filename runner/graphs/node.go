@@ -51,6 +51,6 @@ func (p Path) SizeOf() uintptr {
 		return 0
 	}
 
-	y := unsafe.Sizeof(p[0].(simple.WeightedEdge))
+	y := unsafe.Sizeof(simple.WeightedEdge{})
 	return uintptr(len(p)) * y
 }
@@ -1,18 +1,25 @@
 package graphs
 
 import (
-	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/graph/simple"
 	"math/rand"
 	"runtime"
-	"time"
+	"sort"
+	"sync"
 )
 
 // https://mediatum.ub.tum.de/doc/1315533/file.pdf
 // https://github.com/networkx/networkx/blob/fec20e0a6767eca1b40f19e1cf06387cdaea0f13/networkx/generators/random_graphs.py#L491
-type RandomRegularGenerator struct{}
+type RandomRegularGenerator struct {
+	seed   int64
+	seeded bool
+}
+
+func (r *RandomRegularGenerator) SetSeed(seed int64) {
+	r.seed, r.seeded = seed, true
+}
 
 func (r RandomRegularGenerator) checkConnected(g *simple.WeightedUndirectedGraph, k int) bool {
 	return FindConnectedness(g) >= k
@@ -65,9 +72,7 @@ func makePairs(xs []int64) []pair {
 	return res
 }
 
-func tryCreation(ctx context.Context, n, d int) map[edge]struct{} {
-	rand.Seed(time.Now().Unix())
-
+func tryCreation(r *rand.Rand, n, d int) map[edge]struct{} {
 	edges := make(map[edge]struct{})
 	stubs := make([]int64, 0, n*d)
 	for i := 0; i < d; i++ {
@@ -80,12 +85,8 @@ func tryCreation(ctx context.Context, n, d int) map[edge]struct{} {
 	}
 
 	for len(stubs) > 0 {
-		if ctx.Err() != nil {
-			return nil
-		}
-
 		potentialEdges := make(map[int64]int64)
-		rand.Shuffle(len(stubs), func(i, j int) {
+		r.Shuffle(len(stubs), func(i, j int) {
 			stubs[i], stubs[j] = stubs[j], stubs[i]
 		})
 
@@ -107,9 +108,18 @@ func tryCreation(ctx context.Context, n, d int) map[edge]struct{} {
 			return nil
 		}
 
+		// Sorted, so the shuffle only depends on the random source
+		nodes := make([]int64, 0, len(potentialEdges))
+		for node := range potentialEdges {
+			nodes = append(nodes, node)
+		}
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i] < nodes[j]
+		})
+
 		stubs = nil
-		for node, potential := range potentialEdges {
-			for i := int64(0); i < potential; i++ {
+		for _, node := range nodes {
+			for i := int64(0); i < potentialEdges[node]; i++ {
 				stubs = append(stubs, node)
 			}
 		}
@@ -131,20 +141,26 @@ func (r RandomRegularGenerator) Generate(n, k, d int) (*simple.WeightedUndirecte
 		return nil, errors.Errorf("connectivity cannot be higher than size: k=%v, n=%v", k, n)
 	}
 
+	seed := r.seed
+	if !r.seeded {
+		seed = rand.Int63()
+	}
+
+	// Attempt i uses seed+i, attempts run in batches and the first successful attempt is used. The result does not
+	// depend on the amount of runners or the order in which they finish.
 	runners := runtime.NumCPU()
-	ctx, cancel := context.WithCancel(context.TODO())
-	res := make(chan *simple.WeightedUndirectedGraph, runners)
+	for attempt := 0; ; attempt += runners {
+		res := make([]*simple.WeightedUndirectedGraph, runners)
 
-	for i := 0; i < runners; i++ {
-		go func() {
-			for {
-				if ctx.Err() != nil {
-					return
-				}
+		var wg sync.WaitGroup
+		for i := 0; i < runners; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
 
-				edges := tryCreation(ctx, n, d)
+				edges := tryCreation(rand.New(rand.NewSource(seed+int64(attempt+i))), n, d)
 				if edges == nil {
-					continue
+					return
 				}
 
 				g := simple.NewWeightedUndirectedGraph(0, 0)
@@ -153,17 +169,20 @@ func (r RandomRegularGenerator) Generate(n, k, d int) (*simple.WeightedUndirecte
 				}
 
 				if c := FindConnectedness(g); c >= k {
-					res <- g
+					res[i] = g
 				} else {
 					fmt.Printf("found random graph, connectivity too low: %v < %v\n", c, k)
 				}
+			}(i)
+		}
+		wg.Wait()
+
+		for _, g := range res {
+			if g != nil {
+				return g, nil
 			}
-		}()
+		}
 	}
-
-	g := <-res
-	cancel()
-	return g, nil
 }
 
 func (r RandomRegularGenerator) Cache() (bool, string) {
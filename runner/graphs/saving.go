@@ -1,6 +1,7 @@
 package graphs
 
 import (
+	"bytes"
 	"encoding/gob"
 	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/graph/simple"
@@ -82,3 +83,20 @@ func ReadFromFile(name string) (*simple.WeightedUndirectedGraph, error) {
 
 	return s.Build(), nil
 }
+
+// Encode encodes a graph in the same format as DumpToFile, so it can be sent to other processes
+func Encode(g *simple.WeightedUndirectedGraph) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(newSavedGraph(g))
+
+	return b.Bytes(), errors.Wrap(err, "failed to encode graph")
+}
+
+func Decode(b []byte) (*simple.WeightedUndirectedGraph, error) {
+	var s savedGraph
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&s); err != nil {
+		return nil, errors.Wrap(err, "failed to decode graph")
+	}
+
+	return s.Build(), nil
+}
@@ -2,8 +2,13 @@ package graphs
 
 import (
 	"fmt"
+	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/simple"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize/convex/lp"
+	"math"
+	"sort"
 )
 
 func VerifySolution(g graph.WeightedDirected, s, t graph.Node, k int, paths []Path) bool {
@@ -131,32 +136,270 @@ func maxFlow(edges [][]graph.WeightedEdge, s, t int64) int {
 	}
 }
 
-// Verifies there are k disjoint paths through the graph
+// ValidPath checks whether p is a simple path from s to t, which is required for paths that may have been forged
+func ValidPath(p Path, s, t graph.Node) bool {
+	if len(p) == 0 || p[0].From().ID() != s.ID() || p[len(p)-1].To().ID() != t.ID() {
+		return false
+	}
+
+	seen := map[int64]struct{}{s.ID(): {}}
+
+	for i, e := range p {
+		if i > 0 && p[i-1].To().ID() != e.From().ID() {
+			return false
+		}
+
+		if _, ok := seen[e.To().ID()]; ok {
+			return false
+		}
+
+		seen[e.To().ID()] = struct{}{}
+	}
+
+	return true
+}
+
+// VerifyDisjointPaths verifies that the paths from s to t can not all be blocked by less than k nodes (other than s and
+// t), which is the case when there are k node disjoint paths among them. Invalid paths are ignored. Only paths as a
+// whole are combined, as combining edges of different paths would allow forged paths to be combined with paths of
+// correct processes.
+//
+// Finding the smallest set of nodes blocking all paths is NP-hard, so the paths are accepted when a fractional packing
+// of them exceeds k-1 instead. No set of k-1 nodes can block a packing like that, while k disjoint paths always form one.
 func VerifyDisjointPaths(paths []Path, s, t graph.Node, k int) bool {
-	// TODO: reuse aux data structures
-	g := simple.NewWeightedDirectedGraph(0, 0)
-	max := s.ID()
+	valid := make([]Path, 0, len(paths))
+	for _, p := range paths {
+		if ValidPath(p, s, t) {
+			valid = append(valid, p)
+		}
+	}
 
-	if id := t.ID(); id > max {
-		max = id
+	if len(valid) < k {
+		return false
 	}
 
-	for _, path := range paths {
-		for _, e := range path {
-			g.SetWeightedEdge(g.NewWeightedEdge(e.From(), e.To(), 1))
-			g.SetWeightedEdge(g.NewWeightedEdge(e.To(), e.From(), 1))
+	// Cheap upper bound first: the maximum amount of node disjoint paths in the union of all paths
+	if verifyDisjointUnion(valid, s, t) < k {
+		return false
+	}
+
+	// Paths with the same nodes are interchangeable
+	inner := make([][]int64, 0, len(valid))
+	seen := make(map[string]struct{})
+	for _, p := range valid {
+		nodes := innerNodes(p, s)
+		key := fmt.Sprint(nodes)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		inner = append(inner, nodes)
+	}
+
+	return greedyDisjoint(inner, k) || fractionalDisjoint(inner) > float64(k-1)+disjointTolerance
+}
+
+// innerNodes returns the sorted nodes of p other than s and t. The direct edge from s to t can only be used once, so
+// it uses s.
+func innerNodes(p Path, s graph.Node) []int64 {
+	res := make([]int64, 0, len(p))
+	for _, e := range p[:len(p)-1] {
+		res = append(res, e.To().ID())
+	}
+
+	if len(res) == 0 {
+		res = append(res, s.ID())
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+
+	return res
+}
+
+// greedyDisjoint picks disjoint paths through the least used nodes first, which finds k of them in the common case
+func greedyDisjoint(paths [][]int64, k int) bool {
+	usage := make(map[int64]int)
+	for _, p := range paths {
+		for _, n := range p {
+			usage[n] += 1
+		}
+	}
+
+	load := make([]int, len(paths))
+	order := make([]int, len(paths))
+	for i, p := range paths {
+		for _, n := range p {
+			load[i] += usage[n]
+		}
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return load[order[i]] < load[order[j]]
+	})
+
+	used := make(map[int64]struct{})
+	found := 0
+
+outer:
+	for _, i := range order {
+		for _, n := range paths[i] {
+			if _, ok := used[n]; ok {
+				continue outer
+			}
+		}
 
-			if id := e.To().ID(); id > max {
-				max = id
+		for _, n := range paths[i] {
+			used[n] = struct{}{}
+		}
+
+		if found += 1; found >= k {
+			return true
+		}
+	}
+
+	return false
+}
+
+// packingConstraints returns the row of every node that constrains the packing of the paths. Nodes which are only
+// used by paths that also use some other node add nothing, which keeps the program small when paths are flooded with
+// nodes of their own.
+func packingConstraints(paths [][]int64) map[int64]int {
+	users := make(map[int64]map[int]struct{})
+	for j, p := range paths {
+		for _, n := range p {
+			if users[n] == nil {
+				users[n] = make(map[int]struct{})
+			}
+			users[n][j] = struct{}{}
+		}
+	}
+
+	// dominated reports whether the paths through u include those through v, ties are broken by id
+	dominated := func(v, u int64) bool {
+		if len(users[u]) < len(users[v]) || len(users[u]) == len(users[v]) && u > v {
+			return false
+		}
+
+		for j := range users[v] {
+			if _, ok := users[u][j]; !ok {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	nodes := make([]int64, 0, len(users))
+	for n := range users {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i] < nodes[j]
+	})
+
+	rows := make(map[int64]int)
+outer:
+	for _, v := range nodes {
+		for j := range users[v] {
+			// A node dominating v is used by every path through v, so also by this one
+			for _, u := range paths[j] {
+				if u != v && dominated(v, u) {
+					continue outer
+				}
+			}
+			break
+		}
+
+		rows[v] = len(rows)
+	}
+
+	return rows
+}
+
+// disjointTolerance is the margin by which a fractional packing has to exceed k-1, so rounding errors are not accepted
+const disjointTolerance = 1e-6
+
+// fractionalDisjoint returns the value of a maximum fractional packing of the paths, where every path gets a weight
+// and the weights of the paths through a node add up to at most 1. It solves the linear program
+// max sum y_p s.t. sum_{p through v} y_p + slack_v = 1 and y, slack >= 0, with the slack variables as initial basis.
+func fractionalDisjoint(paths [][]int64) float64 {
+	rows := packingConstraints(paths)
+
+	a := mat.NewDense(len(rows), len(paths)+len(rows), nil)
+	c := make([]float64, len(paths)+len(rows))
+	b := make([]float64, len(rows))
+	basic := make([]int, len(rows))
+
+	for j, p := range paths {
+		c[j] = -1
+		for _, n := range p {
+			if i, ok := rows[n]; ok {
+				a.Set(i, j, 1)
 			}
+		}
+	}
+
+	for i := range b {
+		a.Set(i, len(paths)+i, 1)
+		b[i] = 1
+		basic[i] = len(paths) + i
+	}
 
-			if id := e.From().ID(); id > max {
-				max = id
+	_, x, _ := lp.Simplex(c, a, b, 0, basic)
+	if x == nil {
+		return 0
+	}
+
+	// The packing is scaled down when rounding errors overload a node, so the returned value is always attained
+	total, load := 0.0, make([]float64, len(rows))
+	for j, p := range paths {
+		y := math.Max(x[j], 0)
+		total += y
+		for _, n := range p {
+			if i, ok := rows[n]; ok {
+				load[i] += y
 			}
 		}
 	}
 
-	edges := FindAdjMap(g, max)
+	return total / math.Max(floats.Max(load), 1)
+}
+
+// verifyDisjointUnion computes the maximum amount of node disjoint paths in the union of paths by splitting every node
+// into an in (2*id) and out (2*id+1) node
+func verifyDisjointUnion(paths []Path, s, t graph.Node) int {
+	g := simple.NewWeightedDirectedGraph(0, 0)
+	max := int64(0)
+
+	// Residual edges have weight 0 initially, maxFlow expects them to exist
+	edge := func(from, to int64) {
+		g.SetWeightedEdge(g.NewWeightedEdge(simple.Node(from), simple.Node(to), 1))
+		g.SetWeightedEdge(g.NewWeightedEdge(simple.Node(to), simple.Node(from), 0))
+	}
+
+	split := func(id int64) {
+		if id != s.ID() && id != t.ID() && !g.HasEdgeFromTo(2*id, 2*id+1) {
+			edge(2*id, 2*id+1)
+		}
+
+		if 2*id+1 > max {
+			max = 2*id + 1
+		}
+	}
+
+	for _, path := range paths {
+		for _, e := range path {
+			from, to := e.From().ID(), e.To().ID()
+			split(from)
+			split(to)
+
+			edge(2*from+1, 2*to)
+		}
+	}
 
-	return maxFlow(edges, s.ID(), t.ID()) >= k
+	return maxFlow(FindAdjMap(g, max), 2*s.ID()+1, 2*t.ID())
 }
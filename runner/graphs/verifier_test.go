@@ -0,0 +1,116 @@
+package graphs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/graph/simple"
+	"testing"
+)
+
+func path(nodes ...int64) Path {
+	res := make(Path, 0, len(nodes)-1)
+	for i := 1; i < len(nodes); i++ {
+		res = append(res, simple.WeightedEdge{F: simple.Node(nodes[i-1]), T: simple.Node(nodes[i]), W: 1})
+	}
+
+	return res
+}
+
+func TestVerifyDisjointPaths(t *testing.T) {
+	s, d := simple.Node(0), simple.Node(9)
+
+	// Three node disjoint paths, including the direct edge
+	paths := []Path{path(0, 1, 9), path(0, 2, 3, 9), path(0, 9)}
+	assert.True(t, VerifyDisjointPaths(paths, s, d, 3))
+	assert.False(t, VerifyDisjointPaths(paths, s, d, 4))
+
+	// Edge disjoint, but all through node 5
+	paths = []Path{path(0, 1, 5, 9), path(0, 2, 5, 3, 9), path(0, 5, 4, 9)}
+	assert.False(t, VerifyDisjointPaths(paths, s, d, 2))
+}
+
+func TestVerifyDisjointPathsForged(t *testing.T) {
+	s, d := simple.Node(0), simple.Node(9)
+
+	// Paths that do not connect or repeat nodes are ignored
+	paths := []Path{path(0, 1, 9), append(path(0, 2), path(3, 9)...), path(0, 4, 9, 5, 9)}
+	assert.True(t, VerifyDisjointPaths(paths, s, d, 1))
+	assert.False(t, VerifyDisjointPaths(paths, s, d, 2))
+
+	// The union of both paths contains two disjoint paths (0-1-2-9 and 0-3-4-9), but every path goes through 5
+	paths = []Path{path(0, 1, 2, 5, 4, 9), path(0, 3, 4, 5, 2, 9)}
+	assert.False(t, VerifyDisjointPaths(paths, s, d, 2))
+	assert.True(t, ValidPath(paths[0], s, d))
+}
+
+// overlappingPaths returns paths 0-a-c-9 and 0-c-a-9 for all a in [10, 10+as) and c in [100, 100+cs), their union
+// contains as+cs disjoint paths but at most as of the paths themselves are disjoint
+func overlappingPaths(as, cs int64) []Path {
+	res := make([]Path, 0, 2*as*cs)
+	for a := int64(10); a < 10+as; a++ {
+		for c := int64(100); c < 100+cs; c++ {
+			res = append(res, path(0, a, c, 9), path(0, c, a, 9))
+		}
+	}
+
+	return res
+}
+
+func TestVerifyDisjointPathsOverlapping(t *testing.T) {
+	s, d := simple.Node(0), simple.Node(9)
+
+	paths := overlappingPaths(6, 60)
+	assert.True(t, VerifyDisjointPaths(paths, s, d, 6))
+	assert.False(t, VerifyDisjointPaths(paths, s, d, 7))
+
+	// Disjoint paths of correct processes are found among the overlapping paths
+	for i := int64(0); i < 7; i++ {
+		paths = append(paths, path(0, 200+i, 300+i, 400+i, 9))
+	}
+	assert.True(t, VerifyDisjointPaths(paths, s, d, 7))
+}
+
+func BenchmarkVerifyDisjointPathsOverlapping(b *testing.B) {
+	s, d := simple.Node(0), simple.Node(9)
+	paths := overlappingPaths(6, 60)
+
+	for i := 0; i < b.N; i++ {
+		VerifyDisjointPaths(paths, s, d, 7)
+	}
+}
+
+// floodedPaths returns k disjoint paths of correct processes with 8 relays each, and per Byzantine relay in 5..5+k-2
+// forged paths through that relay and one relay of every correct path. The forged paths use the nodes of the correct
+// paths the least, so they are tried first.
+func floodedPaths(k, forged int) []Path {
+	var res []Path
+	for i := 0; i < forged; i++ {
+		for b := int64(5); b < int64(5+k-1); b++ {
+			p := []int64{0, int64(1000 + i), b}
+			for c := 0; c < k; c++ {
+				p = append(p, int64(100*(c+1)+(i+c)%8))
+			}
+			res = append(res, path(append(p, 9)...))
+		}
+	}
+
+	for c := 0; c < k; c++ {
+		p := []int64{0}
+		for j := 0; j < 8; j++ {
+			p = append(p, int64(100*(c+1)+j))
+		}
+		res = append(res, path(append(p, 9)...))
+	}
+
+	return res
+}
+
+func TestVerifyDisjointPathsFlooded(t *testing.T) {
+	s, d := simple.Node(0), simple.Node(9)
+
+	// The correct paths are accepted, no matter how many forged paths are received before them
+	paths := floodedPaths(3, 1000)
+	assert.True(t, VerifyDisjointPaths(paths, s, d, 3))
+
+	// Without them, all paths are blocked by the two Byzantine relays
+	assert.False(t, VerifyDisjointPaths(paths[:len(paths)-3], s, d, 3))
+}
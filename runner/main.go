@@ -17,6 +17,7 @@ import (
 	"rp-runner/graphs"
 	"rp-runner/process"
 	"runtime"
+	"strings"
 	"time"
 
 	_ "net/http/pprof"
@@ -26,6 +27,10 @@ func init() {
 	gob.Register(simple.WeightedEdge{})
 	gob.Register(simple.Node(0))
 	gob.Register(graphs.Node{})
+	gob.Register(bytePayload{})
+	brb.RegisterPayload(func(b []byte) (brb.Size, error) {
+		return bytePayload(b), nil
+	})
 }
 
 // This function is the main program entry
@@ -60,6 +65,12 @@ func RunnerMain() {
 
 		// Set the verbosity
 		Verbosity: ctrl.SLOW,
+
+		// Behaviour of the Byzantine nodes, see brb.Adversaries for all options (e.g. silent, equivocate, forgePaths)
+		Adversary: "silent",
+
+		// Placement of the Byzantine nodes, see ctrl.Placements for all options (e.g. first, random, betweenness, cut)
+		Placement: "first",
 	}
 	cfg := process.Config{
 		// Connection attempts to controller and neighbours
@@ -118,6 +129,7 @@ func RunnerMain() {
 		// - DolevKnownImproved
 		// - BrachaImproved
 		// - BrachaDolevKnownImproved
+		// - DolevUnknown (for unknown topologies, with the modifications of Bonomi et al.)
 		// Others have been used for testing, but are not updated so might not work anymore
 		Protocol: &brb.DolevKnownImproved{},
 
@@ -157,22 +169,16 @@ func generatePayload(size, run int) bytePayload {
 		return bytePayload(fmt.Sprintf("%v", run))
 	}
 
-	payload := ""
-	for i := 2; i < size; i++ {
-		payload += "X"
-	}
-
-	return bytePayload(fmt.Sprintf("%v_%v", payload, run))
+	return bytePayload(fmt.Sprintf("%v_%v", strings.Repeat("X", size-2), run))
 }
 
-func pickRandom(i int, max int) []uint64 {
+func pickRandom(r *rand.Rand, i int, max int) []uint64 {
 	res := make([]uint64, 0, i)
 	used := make(map[uint64]struct{})
 	overlap := i > max
 
 	for len(res) < i {
-		rand.Seed(time.Now().UnixNano())
-		next := uint64(rand.Intn(max))
+		next := uint64(r.Intn(max))
 
 		if _, ok := used[next]; !overlap && ok {
 			continue
@@ -191,6 +197,15 @@ func (b bytePayload) SizeOf() uintptr {
 	return uintptr(len(b))
 }
 
+func (b bytePayload) MarshalBinary() ([]byte, error) {
+	return b, nil
+}
+
+func (b *bytePayload) UnmarshalBinary(data []byte) error {
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
 type RunConfig struct {
 	Runs, N, K, F, Degree, PayloadSize int
 	MultipleTransmitters               bool
@@ -243,18 +258,41 @@ func runMultipleMessagesTest(runCfg RunConfig, skip bool) error {
 		return errors.Errorf("f >= n/3 (n=%v, f=%v)", runCfg.N, runCfg.F)
 	}
 
+	byzSource := runCfg.ControlCfg.ByzantineSource
+	if byzSource && (runCfg.F == 0 || runCfg.MultipleTransmitters) {
+		return errors.New("a byzantine source requires f > 0 and a single transmitter")
+	}
+
 	messages := 1
 	if runCfg.MultipleTransmitters {
 		messages = runCfg.N - runCfg.F
 	}
 
+	// The transmitters and graph only depend on the seed
+	r := rand.New(rand.NewSource(runCfg.ControlCfg.Seed))
+	if s, ok := runCfg.Generator.(graphs.Seeded); ok {
+		s.SetSeed(r.Int63())
+	}
+
+	// Possible transmitters are picked as indices, the controller maps them to processes when placing the Byzantine ones
 	fmt.Println("generating graph...")
-	ra := pickRandom(runCfg.Runs*messages, runCfg.N-runCfg.F)
+	ra := pickRandom(r, runCfg.Runs*messages, runCfg.N-runCfg.F)
+	if byzSource {
+		// All transmitters will be byzantine, so at most f different transmitters can be used
+		ra = pickRandom(r, runCfg.Runs, runCfg.F)
+	}
 	g, err := runCfg.Generator.Generate(runCfg.N, runCfg.K, runCfg.Degree)
 	if err != nil {
 		return errors.Wrap(err, "failed to generate graph for test")
 	}
 
+	// The properties of every link are fixed for the whole test
+	if runCfg.ControlCfg.Links != nil {
+		if runCfg.ControlCfg.Links, err = process.EdgeLinks(g, runCfg.ControlCfg.Links); err != nil {
+			return errors.Wrap(err, "failed to determine links of graph")
+		}
+	}
+
 	fmt.Printf("everything ready, starting %v test runs\n", runCfg.Runs)
 
 	ctl, err := ctrl.StartController(runCfg.ControlCfg)
@@ -263,19 +301,27 @@ func runMultipleMessagesTest(runCfg RunConfig, skip bool) error {
 	}
 
 	if runCfg.ControlCfg.Verbosity > ctrl.SILENT {
-		fmt.Printf("starting processes\nselected as possible transmitters: %v\n", ra)
+		fmt.Println("starting processes")
 	}
-	err = ctl.StartProcesses(runCfg.ProcessCfg, runCfg.OptimizationCfg, g, runCfg.Protocol, runCfg.F, ra, runCfg.Protocol.Category() == brb.BrachaDolevCat)
+	ra, err = ctl.StartProcesses(runCfg.ProcessCfg, runCfg.OptimizationCfg, g, runCfg.Protocol, runCfg.F, ra, runCfg.Protocol.Category() == brb.BrachaDolevCat)
 	if err != nil {
 		return errors.Wrap(err, "unable to start processes")
 	}
 
+	byzantine := ctl.ByzantineNodes()
+	if runCfg.ControlCfg.Verbosity > ctrl.SILENT {
+		fmt.Printf("selected as possible transmitters: %v\n", ra)
+		fmt.Printf("selected as byzantine nodes: %v\n", byzantine)
+	}
+
 	lats := make([]int, 0, runCfg.Runs)
 	cnts := make([]int, 0, runCfg.Runs)
 	bdMergeds := make([]int, 0, runCfg.Runs)
 	dMergeds := make([]int, 0, runCfg.Runs)
 	pMergeds := make([]int, 0, runCfg.Runs)
 	transmits := make([]int, 0, runCfg.Runs)
+	estimates := make([]int, 0, runCfg.Runs)
+	violations := 0
 
 	for i := 0; i < runCfg.Runs; i++ {
 		fmt.Printf("---\nrun %v: waiting for all process to be alive\n", i)
@@ -305,18 +351,36 @@ func runMultipleMessagesTest(runCfg RunConfig, skip bool) error {
 		fmt.Printf("sent %v messages (%v, round %v, origins %v) of %v bytes, waiting for delivers\n", messages, uids,
 			i, ra[i*messages:i*messages+messages], payload.SizeOf())
 
+		if runCfg.ControlCfg.AdaptiveDelay > 0 {
+			ctl.ScheduleCorruption(uids...)
+		}
+
 		roundLat := time.Duration(0)
 		roundMsg := 0
 		roundBDMerged := 0
 		roundDMerged := 0
 		roundPMerged := 0
+		roundMalformed := 0
+		roundDropped := 0
+		roundRetransmitted := 0
+		roundAcks := 0
+		roundPartitioned := 0
+		roundForged := 0
+		roundRequested := 0
+		roundBeforeHeal, roundAfterHeal := 0, 0
 		roundRelayCnt := 0
 		roundMinRelayCnt := math.MaxInt64
 		roundMaxRelayCnt := 0
 		roundMeanRelayCnt := 0.0
-		roundTransmitted := 0
+		roundTransmitted, roundEstimated := 0, 0
+		roundDelivered := 0
+		roundViolations := make([]ctrl.Violation, 0)
+		roundStuck := false
+		roundSeed := int64(0)
 		for _, uid := range uids {
 			stats := ctl.WaitForDeliver(uid)
+			roundStuck = roundStuck || stats.Stuck
+			roundSeed = stats.ScheduleSeed
 
 			if stats.Latency > roundLat {
 				roundLat = stats.Latency
@@ -335,17 +399,29 @@ func runMultipleMessagesTest(runCfg RunConfig, skip bool) error {
 			roundMeanRelayCnt += stats.MeanRelayCount
 			roundBDMerged += stats.BDMessagedMerged
 			roundTransmitted += stats.BytesTransmitted
+			roundEstimated += stats.EstimatedBytes
 			roundDMerged += stats.DMessagesMerged
 			roundPMerged += stats.PayloadsMerged
+			roundMalformed += stats.Malformed
+			roundDropped += stats.Dropped
+			roundRetransmitted += stats.Retransmitted
+			roundAcks += stats.Acks
+			roundPartitioned += stats.Partitioned
+			roundForged += stats.Forged
+			roundRequested += stats.Requested
+			roundBeforeHeal += stats.DeliveredBeforeHeal
+			roundAfterHeal += stats.DeliveredAfterHeal
+			roundDelivered += stats.Delivered
+			roundViolations = append(roundViolations, stats.Violations...)
 		}
 
 		roundMeanRelayCnt /= float64(messages)
 
 		color.Green("statistics (%v):\n  last delivery latency: %v\n  messages sent: %v (~%v per broadcast)"+
 			"\n  recv: %.2f (%v - %v - %v)\n  bd merged (orbd2): %v\n  d merged (ord5): %v\n  payloads merged (ord6): %v\n  "+
-			"bytes transmitted: %v (~%v per broadcast)\n", i,
+			"bytes transmitted: %v (~%v per broadcast, estimated: %v)\n", i,
 			roundLat, roundMsg, roundMsg/messages, roundMeanRelayCnt, roundRelayCnt, roundMinRelayCnt, roundMaxRelayCnt,
-			roundBDMerged, roundDMerged, roundPMerged, roundTransmitted, roundTransmitted/messages)
+			roundBDMerged, roundDMerged, roundPMerged, roundTransmitted, roundTransmitted/messages, roundEstimated)
 
 		lats = append(lats, int(roundLat))
 		cnts = append(cnts, roundMsg/messages)
@@ -353,8 +429,82 @@ func runMultipleMessagesTest(runCfg RunConfig, skip bool) error {
 		dMergeds = append(dMergeds, roundDMerged)
 		pMergeds = append(pMergeds, roundPMerged)
 		transmits = append(transmits, roundTransmitted/messages)
+		estimates = append(estimates, roundEstimated/messages)
+
+		if roundMalformed > 0 {
+			color.Yellow("  malformed messages dropped: %v\n", roundMalformed)
+		}
+
+		if roundDropped > 0 || roundRetransmitted > 0 || roundAcks > 0 {
+			color.Yellow("  messages lost by links: %v, retransmitted: %v, acks: %v\n", roundDropped,
+				roundRetransmitted, roundAcks)
+		}
+
+		if runCfg.OptimizationCfg.BrachaDigest {
+			color.Yellow("  payloads requested (orb3): %v\n", roundRequested)
+		}
+
+		if roundForged > 0 {
+			color.Yellow("  forged messages rejected: %v\n", roundForged)
+		}
+
+		if runCfg.ControlCfg.Partitions != nil {
+			color.Yellow("  messages held by partitions: %v, deliveries before healing: %v, after healing: %v\n",
+				roundPartitioned, roundBeforeHeal, roundAfterHeal)
+		}
+
+		if byzSource {
+			color.Yellow("  deliveries by correct processes: %v/%v\n", roundDelivered, runCfg.N-runCfg.F)
+		}
+
+		for _, v := range roundViolations {
+			color.Red("  %v violation: process %v delivered %v, wanted %v\n", v.Type, v.Process, v.Got, v.Wanted)
+		}
+		violations += len(roundViolations)
+
+		if roundStuck {
+			color.Red("  stuck: correct processes did not deliver, but no messages are left\n")
+		}
+
+		if runCfg.ProcessCfg.QueueSize > 0 {
+			congestion := ctl.Congestion()
+			overflowed, discarded := 0, 0
+			for _, l := range congestion {
+				overflowed += l.Overflowed
+				discarded += l.Discarded
+			}
+
+			color.Yellow("  messages that did not fit in link queues: %v (discarded: %v)\n", overflowed, discarded)
+			if len(congestion) > 3 {
+				congestion = congestion[:3]
+			}
+
+			for _, l := range congestion {
+				color.Yellow("  queue %v -> %v: max depth %v, mean depth %.2f, overflowed %v\n", l.From, l.To,
+					l.MaxDepth, l.MeanDepth(), l.Overflowed)
+			}
+		}
+
+		if runCfg.ControlCfg.Scheduler != nil && (roundStuck || len(roundViolations) > 0) {
+			// Transmitters and payloads depend on the run as well, so run i is replayed by replaying the whole test
+			color.Red("  replay this run as run %v of the same test using --seed %v --sched-seed %v\n", i,
+				runCfg.ControlCfg.Seed, roundSeed-int64(i))
+		}
 
 		ctl.FlushProcesses()
+
+		// Adaptive adversary: corrupt the most interesting correct process of this run, unless done during the run
+		if runCfg.ControlCfg.AdaptiveDelay == 0 {
+			id, ok, err := ctl.CorruptAdaptive(uids...)
+			if err != nil {
+				return errors.Wrap(err, "unable to corrupt process")
+			}
+
+			if ok {
+				color.Yellow("  corrupted process %v\n", id)
+			}
+		}
+
 		runtime.GC()
 	}
 
@@ -385,10 +535,31 @@ func runMultipleMessagesTest(runCfg RunConfig, skip bool) error {
 	color.Green("  transmits:\n    mean: %.2f (~%.2f per broadcast)\n    sd: %.2f (%.2f%%)\n", tMean,
 		tMean/float64(messages), tSd, tRsd)
 
+	eMean, eSd := sd(estimates)
+	eRsd := eSd * 100 / eMean
+	color.Green("  estimated transmits:\n    mean: %.2f (~%.2f per broadcast)\n    sd: %.2f (%.2f%%)\n", eMean,
+		eMean/float64(messages), eSd, eRsd)
+
+	if violations > 0 {
+		color.Red("  BRB guarantees violated: %v\n", violations)
+	}
+
+	adversary := runCfg.ControlCfg.Adversary
+	if adversary == "" {
+		adversary = "silent"
+	}
+
+	placement := runCfg.ControlCfg.Placement
+	if placement == "" {
+		placement = "first"
+	}
+
 	color.Blue("config:")
-	color.Blue("  nodes: %v\n  connectivity (k): %v\n  byzantine nodes (f): %v"+
-		"\n  runs: %v\n  protocol: %v\n  payload size: %v bytes\n  messages broadcasted: %v\n",
-		runCfg.N, runCfg.K, runCfg.F, runCfg.Runs, reflect.TypeOf(runCfg.Protocol).Elem().Name(), runCfg.PayloadSize, messages)
+	color.Blue("  nodes: %v\n  connectivity (k): %v\n  byzantine nodes (f): %v\n  adversary: %v\n  byzantine source: %v"+
+		"\n  placement: %v %v\n  runs: %v\n  protocol: %v\n  payload size: %v bytes\n  messages broadcasted: %v"+
+		"\n  seed: %v\n",
+		runCfg.N, runCfg.K, runCfg.F, adversary, byzSource, placement, ctl.ByzantineNodes(), runCfg.Runs,
+		reflect.TypeOf(runCfg.Protocol).Elem().Name(), runCfg.PayloadSize, messages, runCfg.ControlCfg.Seed)
 
 	ctl.FlushProcesses()
 	ctl.Close()
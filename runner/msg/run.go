@@ -5,6 +5,9 @@ import "rp-runner/brb"
 const TriggerMessageType uint8 = 5
 const WrapperDataType uint8 = 6
 const MessageDeliveredType uint8 = 7
+const CorruptType uint8 = 8
+const LinkDataType uint8 = 9
+const LinkAckType uint8 = 10
 
 type TriggerMessage struct {
 	Id      uint32
@@ -21,3 +24,20 @@ type MessageDelivered struct {
 	Id      uint32
 	Payload brb.Size
 }
+
+// CorruptMessage instructs a correct process to hand control to the given adversary
+type CorruptMessage struct {
+	Adversary brb.Adversary
+}
+
+// LinkData is a message sent by the reliable link layer, it is retransmitted until it is acknowledged
+type LinkData struct {
+	Seq  uint64
+	Data WrapperDataMessage
+}
+
+// LinkAck acknowledges the LinkData with the same sequence number, Id is only used for statistics
+type LinkAck struct {
+	Seq uint64
+	Id  uint32
+}
@@ -0,0 +1,142 @@
+package process
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"hash"
+	"rp-runner/brb"
+	"rp-runner/msg"
+)
+
+// KeySize is the size of the pairwise keys used to authenticate links
+const KeySize = 32
+
+// LinkKeys generates a pairwise key for every link (edge), both processes of a link get the same key
+func LinkKeys(edges [][2]uint64) (map[uint64]map[uint64][]byte, error) {
+	res := make(map[uint64]map[uint64][]byte)
+
+	for _, e := range edges {
+		key := make([]byte, KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, errors.Wrap(err, "unable to generate link key")
+		}
+
+		for i, from := range e {
+			if res[from] == nil {
+				res[from] = make(map[uint64][]byte)
+			}
+			res[from][e[1-i]] = key
+		}
+	}
+
+	return res, nil
+}
+
+// authenticated returns whether a message is protected by a MAC when links are authenticated, messages of the
+// controller and pings are not
+func authenticated(m Message) bool {
+	if m.Ctl {
+		return false
+	}
+
+	switch m.Type {
+	case msg.WrapperDataType, msg.LinkDataType, msg.LinkAckType:
+		return true
+	default:
+		return false
+	}
+}
+
+// mac computes the MAC of a message on the link from src to dest, covering the link, the type and the protocol data
+// in its wire format. Data that can not be encoded is not authenticated, any other representation of it is not
+// guaranteed to be the same at the sender and the receiver.
+func mac(key []byte, src, dest uint64, m Message) ([]byte, error) {
+	h := hmac.New(sha256.New, key)
+
+	writeUint(h, src)
+	writeUint(h, dest)
+	writeUint(h, uint64(m.Type))
+
+	var err error
+	switch d := m.Data.(type) {
+	case msg.WrapperDataMessage:
+		err = writeData(h, d)
+	case msg.LinkData:
+		writeUint(h, d.Seq)
+		err = writeData(h, d.Data)
+	case msg.LinkAck:
+		writeUint(h, d.Seq)
+		writeUint(h, uint64(d.Id))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+func writeUint(h hash.Hash, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	_, _ = h.Write(b[:])
+}
+
+func writeData(h hash.Hash, d msg.WrapperDataMessage) error {
+	writeUint(h, uint64(d.T))
+	writeUint(h, uint64(d.Id))
+
+	b, err := brb.Encode(d.Data)
+	if err != nil {
+		return errors.Wrap(err, "unable to authenticate protocol data")
+	}
+
+	writeUint(h, uint64(len(b)))
+	_, _ = h.Write(b)
+	return nil
+}
+
+// sign adds the MAC of the link to dest to a message, if links are authenticated. Messages that can not be
+// authenticated are counted as malformed and must not be sent.
+func (p *Process) sign(dest uint64, m Message) (Message, bool) {
+	if p.cfg.Keys == nil || !authenticated(m) {
+		return m, true
+	}
+
+	// A process only has keys for its own links, any other sender (e.g. a forged one) is signed with the key of the
+	// link to dest, which the receiver does not accept
+	tag, err := mac(p.cfg.Keys[dest], m.Src, dest, m)
+	if err != nil {
+		p.sLock.Lock()
+		p.stats.Malformed[uidOf(m)] += 1
+		p.sLock.Unlock()
+
+		return m, false
+	}
+
+	m.MAC = tag
+	return m, true
+}
+
+// verify returns whether a received message carries a valid MAC of the link it claims to be sent over, messages that
+// do not are counted as forged
+func (p *Process) verify(m Message) bool {
+	if p.cfg.Keys == nil || !authenticated(m) {
+		return true
+	}
+
+	if key, ok := p.cfg.Keys[m.Src]; ok {
+		if tag, err := mac(key, m.Src, p.Id, m); err == nil && hmac.Equal(m.MAC, tag) {
+			return true
+		}
+	}
+
+	p.sLock.Lock()
+	p.stats.Forged[uidOf(m)] += 1
+	p.sLock.Unlock()
+
+	return false
+}
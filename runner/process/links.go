@@ -0,0 +1,169 @@
+package process
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/graph/simple"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linkKey identifies an undirected link, links have the same properties in both directions
+func linkKey(a, b uint64) [2]uint64 {
+	if a > b {
+		a, b = b, a
+	}
+
+	return [2]uint64{a, b}
+}
+
+// Validate checks whether the properties of the link are possible
+func (l Link) Validate() error {
+	switch {
+	case l.Latency < 0:
+		return errors.Errorf("latency can not be negative, got %v", l.Latency)
+	case l.Bandwidth < 0:
+		return errors.Errorf("bandwidth can not be negative, got %v", l.Bandwidth)
+	case l.Drop < 0 || l.Drop >= 1:
+		return errors.Errorf("drop probability must be at least 0 and below 1, got %v", l.Drop)
+	case l.Duplicate < 0 || l.Duplicate > 1:
+		return errors.Errorf("duplicate probability must be between 0 and 1, got %v", l.Duplicate)
+	case l.Reorder < 0 || l.Reorder > 1:
+		return errors.Errorf("reorder probability must be between 0 and 1, got %v", l.Reorder)
+	}
+
+	return nil
+}
+
+// SpreadLinks varies the latency and bandwidth of every link randomly by at most Spread (a fraction) around Base. The
+// properties of a link only depend on the seed and the processes it connects.
+type SpreadLinks struct {
+	Base   Link
+	Spread float64
+	Seed   int64
+}
+
+func (s SpreadLinks) Link(src, dest uint64) Link {
+	k := linkKey(src, dest)
+	r := rand.New(rand.NewSource(s.Seed ^ int64(k[0]<<32|k[1])))
+
+	link := s.Base
+	link.Latency = time.Duration(float64(s.Base.Latency) * (1 + s.Spread*(2*r.Float64()-1)))
+	link.Bandwidth = s.Base.Bandwidth * (1 + s.Spread*(2*r.Float64()-1))
+
+	return link
+}
+
+// LinkProfile contains the properties of specific links, all other links are determined by Fallback
+type LinkProfile struct {
+	Links    map[[2]uint64]Link
+	Fallback LinkModel
+}
+
+func (l LinkProfile) Link(src, dest uint64) Link {
+	if link, ok := l.Links[linkKey(src, dest)]; ok {
+		return link
+	}
+
+	return l.Fallback.Link(src, dest)
+}
+
+// EdgeLinks stores the properties of every edge of g as given by model. The edge weights of the graph are capacities
+// used by the routing code, so they are left untouched. Links of a LinkProfile that are not edges of g are rejected.
+func EdgeLinks(g *simple.WeightedUndirectedGraph, model LinkModel) (LinkProfile, error) {
+	res := LinkProfile{Links: make(map[[2]uint64]Link), Fallback: model}
+
+	if p, ok := model.(LinkProfile); ok {
+		for k := range p.Links {
+			if !g.HasEdgeBetween(int64(k[0]), int64(k[1])) {
+				return res, errors.Errorf("link profile contains %v-%v, which is not an edge of the graph", k[0], k[1])
+			}
+		}
+	}
+
+	edges := g.Edges()
+	for edges.Next() {
+		e := edges.Edge()
+		from, to := uint64(e.From().ID()), uint64(e.To().ID())
+
+		link := model.Link(from, to)
+		if err := link.Validate(); err != nil {
+			return res, errors.Wrapf(err, "invalid link %v-%v", from, to)
+		}
+		res.Links[linkKey(from, to)] = link
+	}
+
+	return res, nil
+}
+
+// ReadLinkProfile reads a link profile from a file. Every line describes a link as "<from> <to> <latency>
+// [bandwidth [drop [duplicate [reorder]]]]", where the latency is a duration (e.g. 5ms), the bandwidth is in bytes per
+// second (0 or omitted is unlimited) and the rest are probabilities. Empty lines and lines starting with # are ignored.
+func ReadLinkProfile(name string, fallback LinkModel) (LinkProfile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return LinkProfile{}, errors.Wrap(err, "unable to open link profile")
+	}
+	defer f.Close()
+
+	return readLinkProfile(f, fallback)
+}
+
+func readLinkProfile(r io.Reader, fallback LinkModel) (LinkProfile, error) {
+	res := LinkProfile{Links: make(map[[2]uint64]Link), Fallback: fallback}
+
+	s := bufio.NewScanner(r)
+	for i := 1; s.Scan(); i++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 || len(fields) > 7 {
+			return res, errors.Errorf("line %v of link profile: expected <from> <to> <latency> "+
+				"[bandwidth [drop [duplicate [reorder]]]]", i)
+		}
+
+		from, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return res, errors.Wrapf(err, "line %v of link profile", i)
+		}
+
+		to, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return res, errors.Wrapf(err, "line %v of link profile", i)
+		}
+
+		if from == to {
+			return res, errors.Errorf("line %v of link profile: %v can not be linked to itself", i, from)
+		}
+
+		var link Link
+		if link.Latency, err = time.ParseDuration(fields[2]); err != nil {
+			return res, errors.Wrapf(err, "line %v of link profile", i)
+		}
+
+		values := []*float64{&link.Bandwidth, &link.Drop, &link.Duplicate, &link.Reorder}
+		for j, field := range fields[3:] {
+			if *values[j], err = strconv.ParseFloat(field, 64); err != nil {
+				return res, errors.Wrapf(err, "line %v of link profile", i)
+			}
+		}
+
+		if err := link.Validate(); err != nil {
+			return res, errors.Wrapf(err, "line %v of link profile", i)
+		}
+
+		if _, ok := res.Links[linkKey(from, to)]; ok {
+			return res, errors.Errorf("line %v of link profile: link %v-%v is listed twice", i, from, to)
+		}
+		res.Links[linkKey(from, to)] = link
+	}
+
+	return res, errors.Wrap(s.Err(), "unable to read link profile")
+}
@@ -0,0 +1,69 @@
+package process
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/simple"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLinkProfile(t *testing.T) {
+	fallback := UniformLinks{Latency: time.Millisecond}
+	p, err := readLinkProfile(strings.NewReader(`
+# from to latency bandwidth drop duplicate reorder
+0 1 5ms
+2 1 10ms 1000 0.1 0.2 0.3
+`), fallback)
+	require.NoError(t, err)
+
+	assert.Equal(t, Link{Latency: 5 * time.Millisecond}, p.Link(1, 0))
+	assert.Equal(t, Link{Latency: 10 * time.Millisecond, Bandwidth: 1000, Drop: 0.1, Duplicate: 0.2, Reorder: 0.3},
+		p.Link(1, 2))
+
+	// Links that are not in the profile use the fallback
+	assert.Equal(t, Link(fallback), p.Link(0, 2))
+}
+
+func TestReadLinkProfileInvalid(t *testing.T) {
+	lines := map[string]string{
+		"too few fields":     "0 1",
+		"too many fields":    "0 1 5ms 0 0 0 0 0",
+		"bad node":           "a 1 5ms",
+		"self link":          "1 1 5ms",
+		"bad latency":        "0 1 5",
+		"negative latency":   "0 1 -5ms",
+		"negative bandwidth": "0 1 5ms -100",
+		"certain drop":       "0 1 5ms 0 1",
+		"negative duplicate": "0 1 5ms 0 0 -0.5",
+		"reorder above one":  "0 1 5ms 0 0 0 1.5",
+		"duplicate link":     "0 1 5ms\n1 0 6ms",
+	}
+
+	for name, line := range lines {
+		_, err := readLinkProfile(strings.NewReader(line), UniformLinks{})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEdgeLinks(t *testing.T) {
+	g := simple.NewWeightedUndirectedGraph(0, 0)
+	g.SetWeightedEdge(g.NewWeightedEdge(simple.Node(0), simple.Node(1), 1))
+	g.SetWeightedEdge(g.NewWeightedEdge(simple.Node(1), simple.Node(2), 1))
+
+	spread := SpreadLinks{Base: Link{Latency: time.Millisecond, Bandwidth: 1000}, Spread: 0.5, Seed: 3}
+	links, err := EdgeLinks(g, spread)
+	require.NoError(t, err)
+
+	// A link is stored for every edge
+	assert.Len(t, links.Links, 2)
+	assert.Equal(t, spread.Link(0, 1), links.Link(1, 0))
+
+	p, err := readLinkProfile(strings.NewReader("0 2 5ms"), spread)
+	require.NoError(t, err)
+
+	// Links that are not edges are rejected
+	_, err = EdgeLinks(g, p)
+	assert.Error(t, err)
+}
@@ -5,4 +5,7 @@ type Message struct {
 	Ctl  bool
 	Type uint8
 	Data interface{}
+
+	// Authenticates the link the message was sent over, if links are authenticated
+	MAC []byte
 }
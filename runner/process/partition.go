@@ -0,0 +1,159 @@
+package process
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PartitionPolicy determines what happens to messages sent over a link that is cut by a partition
+type PartitionPolicy int
+
+const (
+	// Messages are sent once the link heals
+	QueuePartitioned PartitionPolicy = iota
+	// Messages are lost
+	DropPartitioned
+)
+
+// Partition cuts all links between processes in A and processes in B from At until Heal, relative to the start of a
+// run. Links within A or within B are not affected. An empty B contains all processes that are not in A.
+type Partition struct {
+	At, Heal time.Duration
+	A, B     map[uint64]bool
+}
+
+func (p Partition) separates(a, b uint64) bool {
+	inB := func(id uint64) bool {
+		if len(p.B) == 0 {
+			return !p.A[id]
+		}
+
+		return p.B[id]
+	}
+
+	return (p.A[a] && inB(b)) || (p.A[b] && inB(a))
+}
+
+// Partitions is a schedule of partitions shared by all processes, a run starts with its first broadcast
+type Partitions struct {
+	Schedule []Partition
+	Policy   PartitionPolicy
+
+	start time.Time
+	lock  sync.Mutex
+}
+
+// Start starts the schedule at t, unless it was already started
+func (p *Partitions) Start(t time.Time) {
+	p.lock.Lock()
+	if p.start.IsZero() {
+		p.start = t
+	}
+	p.lock.Unlock()
+}
+
+// Stop stops the schedule at the end of a run, links are not cut until it is started again
+func (p *Partitions) Stop() {
+	p.lock.Lock()
+	p.start = time.Time{}
+	p.lock.Unlock()
+}
+
+// Healed returns when the last partition of the current run heals
+func (p *Partitions) Healed() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	heal := time.Duration(0)
+	for _, part := range p.Schedule {
+		if part.Heal > heal {
+			heal = part.Heal
+		}
+	}
+
+	return p.start.Add(heal)
+}
+
+// cut returns whether the link between a and b is cut at time now, and when it heals
+func (p *Partitions) cut(a, b uint64, now time.Time) (time.Time, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.start.IsZero() {
+		return time.Time{}, false
+	}
+
+	t := now.Sub(p.start)
+	heal := time.Duration(0)
+	for _, part := range p.Schedule {
+		if t >= part.At && t < part.Heal && part.Heal > heal && part.separates(a, b) {
+			heal = part.Heal
+		}
+	}
+
+	return p.start.Add(heal), heal > 0
+}
+
+func parseIds(s string) (map[uint64]bool, error) {
+	res := make(map[uint64]bool)
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+
+		id, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res[id] = true
+	}
+
+	return res, nil
+}
+
+// ParsePartition parses a partition written as "<at>-<heal>:<A>[/<B>]", where at and heal are durations (e.g. 200ms)
+// and A and B are comma separated process ids. For example, "200ms-1s:0,1,2" cuts processes 0, 1 and 2 off from all
+// other processes between 200ms and 1s.
+func ParsePartition(s string) (Partition, error) {
+	var res Partition
+
+	times, sets := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		times, sets = s[:i], s[i+1:]
+	}
+
+	ts := strings.Split(times, "-")
+	if len(ts) != 2 || sets == "" {
+		return res, errors.Errorf("partition %q should be written as <at>-<heal>:<A>[/<B>]", s)
+	}
+
+	var err error
+	if res.At, err = time.ParseDuration(ts[0]); err != nil {
+		return res, errors.Wrapf(err, "partition %q", s)
+	}
+	if res.Heal, err = time.ParseDuration(ts[1]); err != nil {
+		return res, errors.Wrapf(err, "partition %q", s)
+	}
+	if res.Heal <= res.At {
+		return res, errors.Errorf("partition %q heals before it starts", s)
+	}
+
+	ab := strings.Split(sets, "/")
+	if len(ab) > 2 {
+		return res, errors.Errorf("partition %q should have at most two sets of processes", s)
+	}
+
+	if res.A, err = parseIds(ab[0]); err != nil {
+		return res, errors.Wrapf(err, "partition %q", s)
+	}
+	if len(ab) == 2 {
+		if res.B, err = parseIds(ab[1]); err != nil {
+			return res, errors.Wrapf(err, "partition %q", s)
+		}
+	}
+
+	return res, nil
+}
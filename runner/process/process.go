@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"go.uber.org/atomic"
+	"math/rand"
 	"os"
 	"rp-runner/brb"
 	"rp-runner/msg"
@@ -16,6 +17,30 @@ type Config struct {
 	MaxRetries                 int
 	RetryDelay, NeighbourDelay time.Duration
 	ByzConfig                  brb.Config
+
+	// Messages between processes are handled by the simulator if set, otherwise every process runs in its own routine
+	Simulator *Simulator
+
+	// Links determines the loss of messages between processes, links are perfect when not set. Lost messages are
+	// retransmitted by a reliable link layer if Reliable is set, after RetransmitTimeout without an acknowledgement.
+	Links             LinkModel
+	Reliable          bool
+	RetransmitTimeout time.Duration
+
+	// Links between processes are cut according to the schedule if set
+	Partitions *Partitions
+
+	// Messages to every neighbour are queued in a queue of QueueSize messages, when it is full the overflow policy is
+	// used. Without a queue size, a routine is started for every message that does not fit in a channel.
+	QueueSize int
+	Overflow  OverflowPolicy
+	SpillDir  string
+
+	// Seed of the randomness of the links
+	Seed int64
+
+	// Pairwise keys shared with every neighbour, messages between processes are authenticated using a MAC if set
+	Keys map[uint64][]byte
 }
 
 type Stats struct {
@@ -24,8 +49,16 @@ type Stats struct {
 	Relayed          map[uint32]int
 	BDMerged         map[uint32]int
 	BytesTransmitted map[uint32]uintptr
+	EstimatedBytes   map[uint32]uintptr
 	DMerged          map[uint32]int
 	PayloadsMerged   map[uint32]int
+	Malformed        map[uint32]int
+	Dropped          map[uint32]int
+	Retransmitted    map[uint32]int
+	Acks             map[uint32]int
+	Partitioned      map[uint32]int
+	Forged           map[uint32]int
+	Requested        map[uint32]int
 }
 
 type Process struct {
@@ -43,6 +76,11 @@ type Process struct {
 	brb brb.Protocol
 
 	neighbours map[uint64]bool
+	link       *reliableLink
+	queues     map[uint64]*outQueue
+
+	rand  map[uint64]*rand.Rand
+	rLock sync.Mutex
 }
 
 func StartProcess(id uint64, cfg Config, stopCh <-chan struct{}, neighbours []uint64, brb brb.Protocol, ctl chan Message) (*Process, error) {
@@ -57,10 +95,35 @@ func StartProcess(id uint64, cfg Config, stopCh <-chan struct{}, neighbours []ui
 		Relayed:          make(map[uint32]int),
 		BDMerged:         make(map[uint32]int),
 		BytesTransmitted: make(map[uint32]uintptr),
+		EstimatedBytes:   make(map[uint32]uintptr),
 		DMerged:          make(map[uint32]int),
 		PayloadsMerged:   make(map[uint32]int),
+		Malformed:        make(map[uint32]int),
+		Dropped:          make(map[uint32]int),
+		Retransmitted:    make(map[uint32]int),
+		Acks:             make(map[uint32]int),
+		Partitioned:      make(map[uint32]int),
+		Forged:           make(map[uint32]int),
+		Requested:        make(map[uint32]int),
+	}
+	// Adversaries get their own source, derived from the seed of the process
+	cfg.ByzConfig.Rand = rand.New(rand.NewSource(rand.New(rand.NewSource(cfg.Seed)).Int63()))
+
+	p := &Process{ctl: ctl, flushing: atomic.NewBool(false), Id: id, cfg: cfg, stopCh: stopCh, stats: stats, brb: brb,
+		neighbours: nmap, rand: make(map[uint64]*rand.Rand)}
+
+	if cfg.Reliable {
+		// Without a timeout unacknowledged messages would be retransmitted forever at the same (virtual) time
+		if cfg.RetransmitTimeout <= 0 {
+			return nil, errors.Errorf("retransmit timeout of a reliable link must be positive, got %v", cfg.RetransmitTimeout)
+		}
+
+		p.link = newReliableLink(p)
+	}
+
+	if cfg.Simulator != nil {
+		cfg.Simulator.register(p)
 	}
-	p := &Process{ctl: ctl, flushing: atomic.NewBool(false), Id: id, cfg: cfg, stopCh: stopCh, stats: stats, brb: brb, neighbours: nmap}
 
 	return p, nil
 }
@@ -68,6 +131,24 @@ func StartProcess(id uint64, cfg Config, stopCh <-chan struct{}, neighbours []ui
 func (p *Process) Start(channels map[uint64]chan Message) error {
 	p.channels = channels
 
+	if p.cfg.QueueSize > 0 {
+		p.queues = make(map[uint64]*outQueue, len(p.neighbours))
+		for n := range p.neighbours {
+			q, err := newOutQueue(p, n, channels[n])
+			if err != nil {
+				return err
+			}
+			p.queues[n] = q
+		}
+
+		go func() {
+			<-p.stopCh
+			for _, q := range p.queues {
+				q.close()
+			}
+		}()
+	}
+
 	if err := p.waitForConnection(); err != nil {
 		return errors.Wrap(err, "unable to communicate with controller")
 	}
@@ -95,25 +176,132 @@ func (p *Process) send(id uint64, t uint8, b interface{}, ctrl bool) error {
 	if ctrl {
 		p.ctl <- m
 	} else if !p.flushing.Load() {
-		c, ok := p.channels[id]
-		if !ok {
+		if _, ok := p.channels[id]; !ok {
 			return errors.Errorf("proc %v is not connected to %v", p.Id, id)
 		}
 
-		select {
-		case c <- m:
-			break
-		default:
-			// Allows runs to go over proc limit, at the expensive of exploding memory usage
-			go func() {
-				c <- m
-			}()
+		if p.link != nil && t == msg.WrapperDataType {
+			p.link.send(id, m)
+		} else {
+			p.transmit(id, m)
 		}
 	}
 
 	return nil
 }
 
+// transmit sends a message over the (lossy) link to process id
+func (p *Process) transmit(id uint64, m Message) {
+	copies, delay := 1, time.Duration(0)
+	m, ok := p.sign(id, m)
+	if !ok {
+		return
+	}
+
+	if p.cfg.Partitions != nil && m.Type != msg.RunnerPingType {
+		now := p.now()
+		if heal, ok := p.cfg.Partitions.cut(p.Id, id, now); ok {
+			p.sLock.Lock()
+			p.stats.Partitioned[uidOf(m)] += 1
+			p.sLock.Unlock()
+
+			if p.cfg.Partitions.Policy == QueuePartitioned {
+				p.after(id, heal.Sub(now), func() {
+					if !p.flushing.Load() {
+						p.transmit(id, m)
+					}
+				})
+			}
+
+			return
+		}
+	}
+
+	// Only protocol messages are lost, processes need to be able to reach their neighbours
+	if p.cfg.Links != nil && m.Type != msg.RunnerPingType {
+		l := p.cfg.Links.Link(p.Id, id)
+
+		p.rLock.Lock()
+		r := p.linkRand(id)
+		drop, duplicate, reorder := r.Float64() < l.Drop, r.Float64() < l.Duplicate, r.Float64() < l.Reorder
+		if reorder {
+			delay = time.Duration(r.Int63n(int64(ReorderDelay)))
+		}
+		p.rLock.Unlock()
+
+		if drop {
+			p.sLock.Lock()
+			p.stats.Dropped[uidOf(m)] += 1
+			p.sLock.Unlock()
+			return
+		}
+
+		if duplicate {
+			copies = 2
+		}
+	}
+
+	for i := 0; i < copies; i++ {
+		if p.cfg.Simulator != nil && m.Type != msg.RunnerPingType {
+			p.cfg.Simulator.transmit(id, m, delay)
+		} else if delay > 0 {
+			time.AfterFunc(delay, func() {
+				if !p.flushing.Load() {
+					p.push(id, m)
+				}
+			})
+		} else {
+			p.push(id, m)
+		}
+	}
+}
+
+// linkRand returns the source of randomness of the link to process id, every link has its own so losses do not depend
+// on the order in which messages to different processes are sent. Must be called while holding rLock.
+func (p *Process) linkRand(id uint64) *rand.Rand {
+	r, ok := p.rand[id]
+	if !ok {
+		r = rand.New(rand.NewSource(p.cfg.Seed ^ int64(id)<<32))
+		p.rand[id] = r
+	}
+
+	return r
+}
+
+// push moves a message into the channel of process id, using the queue of the link if there is one
+func (p *Process) push(id uint64, m Message) {
+	if q, ok := p.queues[id]; ok {
+		q.push(m)
+		return
+	}
+
+	c := p.channels[id]
+
+	select {
+	case c <- m:
+		break
+	default:
+		// Allows runs to go over proc limit, at the expensive of exploding memory usage
+		go func() {
+			c <- m
+		}()
+	}
+}
+
+// after runs fn after duration d for a message to dest, in virtual time when simulated
+func (p *Process) after(dest uint64, d time.Duration, fn func()) {
+	if p.cfg.Simulator != nil {
+		p.cfg.Simulator.after(p.Id, dest, d, fn)
+	} else {
+		time.AfterFunc(d, fn)
+	}
+}
+
+// After runs fn after duration d for a message to dest, which is virtual when simulated
+func (p *Process) After(dest uint64, d time.Duration, fn func()) {
+	p.after(dest, d, fn)
+}
+
 func (p *Process) checkNeighbours() {
 	m := msg.RunnerStatus{ID: p.Id}
 
@@ -175,6 +363,14 @@ func (p *Process) waitForConnection() error {
 func (p *Process) Flush() {
 	p.flushing.Store(true)
 
+	if p.link != nil {
+		p.link.reset()
+	}
+
+	for _, q := range p.queues {
+		q.clear()
+	}
+
 	go func() {
 		for {
 			select {
@@ -207,7 +403,18 @@ func (p *Process) run() {
 			continue
 		}
 
-		p.handleMsg(m.Src, m.Type, m.Data, m.Ctl)
+		// All messages are handled by the simulator, so processes never run concurrently. Pings arrive whenever their
+		// routine runs and are not handled, so they are kept out of the schedule.
+		if p.cfg.Simulator != nil {
+			if m.Type != msg.RunnerPingType {
+				p.cfg.Simulator.Inject(p.Id, m)
+			}
+			continue
+		}
+
+		if p.verify(m) {
+			p.handleMsg(m.Src, m.Type, m.Data, m.Ctl)
+		}
 	}
 }
 
@@ -223,6 +430,18 @@ func (p *Process) handleMsg(src uint64, t uint8, b interface{}, ctrl bool) {
 		r := b.(msg.WrapperDataMessage)
 
 		p.brb.Receive(r.T, src, r.Id, r.Data)
+	case msg.LinkDataType:
+		r := b.(msg.LinkData)
+
+		if p.link != nil && p.link.receive(src, r) {
+			p.brb.Receive(r.Data.T, src, r.Data.Id, r.Data.Data)
+		}
+	case msg.LinkAckType:
+		r := b.(msg.LinkAck)
+
+		if p.link != nil {
+			p.link.ack(src, r)
+		}
 	case msg.TriggerMessageType:
 		r := b.(msg.TriggerMessage)
 
@@ -231,6 +450,14 @@ func (p *Process) handleMsg(src uint64, t uint8, b interface{}, ctrl bool) {
 		//p.stats.BDMerged[r.Id] = 0
 		//p.stats.BytesTransmitted[r.Id] = 0
 		p.brb.Broadcast(r.Id, r.Payload, brb.BroadcastInfo{})
+	case msg.CorruptType:
+		r := b.(msg.CorruptMessage)
+
+		if c, ok := p.brb.(*brb.Corruptible); ok {
+			c.Corrupt(r.Adversary)
+		} else {
+			fmt.Printf("process %v can not be corrupted\n", p.Id)
+		}
 	}
 }
 
@@ -250,7 +477,7 @@ func (p *Process) Deliver(uid uint32, payload brb.Size, _ uint64) {
 	}
 
 	p.sLock.Lock()
-	p.stats.Deliveries[uid] = time.Now()
+	p.stats.Deliveries[uid] = p.now()
 	p.sLock.Unlock()
 }
 
@@ -271,10 +498,40 @@ func (p *Process) Send(messageType uint8, dest uint64, uid uint32, data brb.Size
 
 	p.sLock.Lock()
 	p.stats.MsgSent[uid] += 1
-	p.stats.BytesTransmitted[uid] += data.SizeOf()
+	p.stats.BytesTransmitted[uid] += brb.WireSize(data)
+	p.stats.EstimatedBytes[uid] += data.SizeOf()
+	p.sLock.Unlock()
+}
+
+// SendAs sends protocol data to dest as if it was sent by src, which is only used by adversaries to impersonate other
+// processes. Forged messages are sent over the link to dest without the reliable link layer.
+func (p *Process) SendAs(src uint64, messageType uint8, dest uint64, uid uint32, data brb.Size) {
+	if _, ok := p.channels[dest]; !ok || p.flushing.Load() {
+		return
+	}
+
+	p.transmit(dest, Message{
+		Src:  src,
+		Type: msg.WrapperDataType,
+		Data: msg.WrapperDataMessage{T: messageType, Id: uid, Data: data},
+	})
+
+	p.sLock.Lock()
+	p.stats.MsgSent[uid] += 1
+	p.stats.BytesTransmitted[uid] += brb.WireSize(data)
+	p.stats.EstimatedBytes[uid] += data.SizeOf()
 	p.sLock.Unlock()
 }
 
+// now returns the virtual time when simulated
+func (p *Process) now() time.Time {
+	if p.cfg.Simulator != nil {
+		return p.cfg.Simulator.Now()
+	}
+
+	return time.Now()
+}
+
 func (p *Process) Stats() Stats {
 	p.sLock.Lock()
 	defer p.sLock.Unlock()
@@ -288,6 +545,16 @@ func (p *Process) Stats() Stats {
 	return s
 }
 
+// QueueStats returns the statistics of the queue of every link to a neighbour since the last flush
+func (p *Process) QueueStats() map[uint64]QueueStats {
+	res := make(map[uint64]QueueStats, len(p.queues))
+	for n, q := range p.queues {
+		res[n] = q.getStats()
+	}
+
+	return res
+}
+
 func (p *Process) TriggerStat(uid uint32, n brb.NetworkStat) {
 	p.sLock.Lock()
 	switch n {
@@ -299,6 +566,10 @@ func (p *Process) TriggerStat(uid uint32, n brb.NetworkStat) {
 		p.stats.DMerged[uid] += 1
 	case brb.DolevPayloadMerge:
 		p.stats.PayloadsMerged[uid] += 1
+	case brb.MalformedMessage:
+		p.stats.Malformed[uid] += 1
+	case brb.PayloadRequest:
+		p.stats.Requested[uid] += 1
 	}
 	p.sLock.Unlock()
 }
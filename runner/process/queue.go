@@ -0,0 +1,262 @@
+package process
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"rp-runner/msg"
+	"sync"
+)
+
+func init() {
+	gob.Register(msg.WrapperDataMessage{})
+	gob.Register(msg.LinkData{})
+	gob.Register(msg.LinkAck{})
+	gob.Register([]byte{})
+}
+
+// OverflowPolicy determines what happens to messages sent to a neighbour whose outbound queue is full
+type OverflowPolicy int
+
+const (
+	// The sender waits until there is space in the queue. A waiting sender does not handle its incoming messages, so
+	// two neighbours that both wait for space in their queue to each other wait forever (until the processes are
+	// flushed). Only simulated runs are reported as stuck and those do not use the queues, so the run hangs.
+	BlockOverflow OverflowPolicy = iota
+	// The oldest message in the queue is lost
+	DropOldestOverflow
+	// Messages are written to disk until there is space in the queue
+	SpillOverflow
+)
+
+// QueueStats describes the outbound queue of a link, the depth is measured every time a message has been queued
+type QueueStats struct {
+	MaxDepth, TotalDepth, Queued int
+
+	// Amount of messages that did not fit in the queue
+	Overflowed int
+	// Amount of messages removed from a full queue to make space, these are not lost by the link itself
+	Discarded int
+}
+
+// outQueue is a bounded queue of messages sent to a neighbour, a routine moves them to the channel of the neighbour
+type outQueue struct {
+	p    *Process
+	dest uint64
+	ch   chan Message
+
+	buf    []Message
+	spill  *spillFile
+	stats  QueueStats
+	closed bool
+	lock   sync.Mutex
+	cond   *sync.Cond
+}
+
+func newOutQueue(p *Process, dest uint64, ch chan Message) (*outQueue, error) {
+	q := &outQueue{p: p, dest: dest, ch: ch}
+	q.cond = sync.NewCond(&q.lock)
+
+	if p.cfg.Overflow == SpillOverflow {
+		f, err := os.CreateTemp(p.cfg.SpillDir, fmt.Sprintf("spill-%v-%v-*", p.Id, dest))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create spill file")
+		}
+		q.spill = &spillFile{f: f}
+	}
+
+	go q.run()
+
+	return q, nil
+}
+
+func (q *outQueue) push(m Message) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	// Spilled messages are older, so new messages are spilled as well until the spill file is empty
+	if len(q.buf) >= q.p.cfg.QueueSize || (q.spill != nil && q.spill.len() > 0) {
+		q.stats.Overflowed += 1
+
+		switch q.p.cfg.Overflow {
+		case BlockOverflow:
+			for len(q.buf) >= q.p.cfg.QueueSize && !q.closed && !q.p.flushing.Load() {
+				q.cond.Wait()
+			}
+		case DropOldestOverflow:
+			q.stats.Discarded += 1
+			q.buf = q.buf[1:]
+		case SpillOverflow:
+			if err := q.spill.write(m); err != nil {
+				fmt.Printf("process %v failed to spill message to %v: %v\n", q.p.Id, q.dest, err)
+				os.Exit(1)
+			}
+
+			q.record()
+			q.cond.Broadcast()
+			return
+		}
+	}
+
+	q.buf = append(q.buf, m)
+	q.record()
+	q.cond.Broadcast()
+}
+
+// record measures the depth of the queue after a message was queued, must be called while holding lock
+func (q *outQueue) record() {
+	depth := len(q.buf)
+	if q.spill != nil {
+		depth += q.spill.len()
+	}
+
+	q.stats.Queued += 1
+	q.stats.TotalDepth += depth
+	if depth > q.stats.MaxDepth {
+		q.stats.MaxDepth = depth
+	}
+}
+
+// pop waits for the next message, and moves spilled messages back into the queue when there is space
+func (q *outQueue) pop() (Message, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.buf) == 0 && (q.spill == nil || q.spill.len() == 0) && !q.closed {
+		q.cond.Wait()
+	}
+
+	if q.closed {
+		return Message{}, false
+	}
+
+	for q.spill != nil && q.spill.len() > 0 && len(q.buf) < q.p.cfg.QueueSize {
+		m, err := q.spill.read()
+		if err != nil {
+			fmt.Printf("process %v failed to read spilled message to %v: %v\n", q.p.Id, q.dest, err)
+			os.Exit(1)
+		}
+		q.buf = append(q.buf, m)
+	}
+
+	m := q.buf[0]
+	q.buf = q.buf[1:]
+	q.cond.Broadcast()
+
+	return m, true
+}
+
+func (q *outQueue) run() {
+	for {
+		m, ok := q.pop()
+		if !ok {
+			return
+		}
+
+		select {
+		case q.ch <- m:
+		case <-q.p.stopCh:
+			return
+		}
+	}
+}
+
+func (q *outQueue) getStats() QueueStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.stats
+}
+
+// clear drops all queued messages and resets the statistics
+func (q *outQueue) clear() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.buf = nil
+	if q.spill != nil {
+		q.spill.reset()
+	}
+
+	q.stats = QueueStats{}
+	q.cond.Broadcast()
+}
+
+// close stops the queue and removes its spill file
+func (q *outQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	if q.spill != nil {
+		_ = q.spill.f.Close()
+		_ = os.Remove(q.spill.f.Name())
+	}
+
+	q.cond.Broadcast()
+}
+
+// spillFile is a queue of messages on disk, all messages are gob encoded and prefixed by their length
+type spillFile struct {
+	f               *os.File
+	offset, written int64
+	count           int
+}
+
+func (s *spillFile) len() int {
+	return s.count
+}
+
+func (s *spillFile) write(m Message) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return err
+	}
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(buf.Len()))
+	if _, err := s.f.WriteAt(append(size[:], buf.Bytes()...), s.written); err != nil {
+		return err
+	}
+
+	s.written += int64(4 + buf.Len())
+	s.count += 1
+
+	return nil
+}
+
+func (s *spillFile) read() (Message, error) {
+	var m Message
+
+	var size [4]byte
+	if _, err := s.f.ReadAt(size[:], s.offset); err != nil {
+		return m, err
+	}
+
+	data := make([]byte, binary.LittleEndian.Uint32(size[:]))
+	if _, err := s.f.ReadAt(data, s.offset+4); err != nil {
+		return m, err
+	}
+
+	s.offset += int64(4 + len(data))
+	s.count -= 1
+
+	// Start at the beginning of the file once all messages are read, so it does not keep growing
+	if s.count == 0 {
+		s.reset()
+	}
+
+	return m, gob.NewDecoder(bytes.NewReader(data)).Decode(&m)
+}
+
+func (s *spillFile) reset() {
+	s.offset, s.written, s.count = 0, 0, 0
+	_ = s.f.Truncate(0)
+}
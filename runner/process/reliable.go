@@ -0,0 +1,143 @@
+package process
+
+import (
+	"rp-runner/brb"
+	"rp-runner/msg"
+	"sync"
+	"time"
+)
+
+// ReorderDelay is the maximum additional delay of a reordered message
+const ReorderDelay = 10 * time.Millisecond
+
+// maxBackoff limits how often the retransmission timeout of a message is doubled
+const maxBackoff = 6
+
+// messageSize returns the amount of bytes needed to transmit a message between processes
+func messageSize(m Message) uintptr {
+	switch d := m.Data.(type) {
+	case msg.WrapperDataMessage:
+		return brb.WireSize(d.Data)
+	case msg.LinkData:
+		return 8 + brb.WireSize(d.Data.Data)
+	case msg.LinkAck:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// uidOf returns the broadcast a message between processes belongs to
+func uidOf(m Message) uint32 {
+	switch d := m.Data.(type) {
+	case msg.WrapperDataMessage:
+		return d.Id
+	case msg.LinkData:
+		return d.Data.Id
+	case msg.LinkAck:
+		return d.Id
+	default:
+		return 0
+	}
+}
+
+// reliableLink is a link layer between the protocol and the (lossy) links. Messages are numbered per link and
+// retransmitted until they are acknowledged, the receiver acknowledges every copy but only hands the first to the
+// protocol. Links are authenticated, so acknowledgements can not be forged.
+type reliableLink struct {
+	p *Process
+
+	next     map[uint64]uint64
+	unacked  map[uint64]map[uint64]Message
+	received map[uint64]map[uint64]bool
+	lock     sync.Mutex
+}
+
+func newReliableLink(p *Process) *reliableLink {
+	r := &reliableLink{p: p}
+	r.reset()
+
+	return r
+}
+
+func (r *reliableLink) send(dest uint64, m Message) {
+	r.lock.Lock()
+	seq := r.next[dest]
+	r.next[dest] += 1
+
+	m.Type = msg.LinkDataType
+	m.Data = msg.LinkData{Seq: seq, Data: m.Data.(msg.WrapperDataMessage)}
+
+	if r.unacked[dest] == nil {
+		r.unacked[dest] = make(map[uint64]Message)
+	}
+	r.unacked[dest][seq] = m
+	r.lock.Unlock()
+
+	r.p.transmit(dest, m)
+	r.retransmit(dest, seq, 0)
+}
+
+// retransmit resends a message until it is acknowledged, the timeout doubles after every retransmission so congested
+// links are not flooded with retransmissions
+func (r *reliableLink) retransmit(dest, seq uint64, attempt int) {
+	r.p.after(dest, r.p.cfg.RetransmitTimeout<<attempt, func() {
+		r.lock.Lock()
+		m, ok := r.unacked[dest][seq]
+		r.lock.Unlock()
+
+		if !ok || r.p.flushing.Load() {
+			return
+		}
+
+		r.p.sLock.Lock()
+		r.p.stats.Retransmitted[uidOf(m)] += 1
+		r.p.sLock.Unlock()
+
+		if attempt < maxBackoff {
+			attempt += 1
+		}
+
+		r.p.transmit(dest, m)
+		r.retransmit(dest, seq, attempt)
+	})
+}
+
+// receive acknowledges a message and returns whether it has not been received before
+func (r *reliableLink) receive(src uint64, d msg.LinkData) bool {
+	ack := Message{Src: r.p.Id, Type: msg.LinkAckType, Data: msg.LinkAck{Seq: d.Seq, Id: d.Data.Id}}
+	r.p.transmit(src, ack)
+
+	r.p.sLock.Lock()
+	r.p.stats.Acks[d.Data.Id] += 1
+	r.p.sLock.Unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.received[src] == nil {
+		r.received[src] = make(map[uint64]bool)
+	}
+
+	if r.received[src][d.Seq] {
+		return false
+	}
+
+	r.received[src][d.Seq] = true
+	return true
+}
+
+func (r *reliableLink) ack(src uint64, a msg.LinkAck) {
+	r.lock.Lock()
+	delete(r.unacked[src], a.Seq)
+	r.lock.Unlock()
+}
+
+// reset forgets all messages, which stops their retransmission
+func (r *reliableLink) reset() {
+	r.lock.Lock()
+	r.next = make(map[uint64]uint64)
+	r.unacked = make(map[uint64]map[uint64]Message)
+	r.received = make(map[uint64]map[uint64]bool)
+	r.lock.Unlock()
+}
@@ -0,0 +1,157 @@
+package process
+
+import (
+	"math/rand"
+	"rp-runner/brb"
+	"rp-runner/brb/algo"
+	"rp-runner/msg"
+	"sort"
+)
+
+// ScheduleBias determines which in-flight event is preferred by a Scheduler
+type ScheduleBias int
+
+const (
+	// Every event is equally likely to be handled next
+	RandomSchedule ScheduleBias = iota
+	// Events for the starved process are only handled when there is nothing else to handle
+	StarveSchedule
+	// The event that was scheduled last is handled first
+	LIFOSchedule
+	// Messages that travelled the longest path are handled first
+	ReversePathSchedule
+)
+
+// Scheduler makes the simulator handle in-flight events in an adversarial order instead of in order of arrival. With
+// probability Strength the event preferred by Bias is picked, otherwise any event is picked. All choices are made
+// using a PRNG, so a schedule can be replayed using its seed.
+type Scheduler struct {
+	Bias     ScheduleBias
+	Strength float64
+	Starved  uint64
+
+	seed int64
+	r    *rand.Rand
+}
+
+func NewScheduler(bias ScheduleBias, strength float64, starved uint64, seed int64) *Scheduler {
+	s := &Scheduler{Bias: bias, Strength: strength, Starved: starved}
+	s.Reset(seed)
+
+	return s
+}
+
+// Reset restarts the schedule using a new seed
+func (s *Scheduler) Reset(seed int64) {
+	s.seed = seed
+	s.r = rand.New(rand.NewSource(seed))
+}
+
+// Seed returns the seed of the current schedule
+func (s *Scheduler) Seed() int64 {
+	return s.seed
+}
+
+// next returns the index of the event that is handled next. Events are picked from the candidates in queue order
+// instead of their position in the heap, as that depends on the order in which events were pushed.
+func (s *Scheduler) next(q eventQueue) int {
+	all := func() []int {
+		res := make([]int, len(q))
+		for i := range q {
+			res[i] = i
+		}
+		return res
+	}
+
+	if s.Bias == RandomSchedule || s.r.Float64() >= s.Strength {
+		return s.pick(q, all())
+	}
+
+	var candidates []int
+	switch s.Bias {
+	case StarveSchedule:
+		for i, e := range q {
+			if e.fn != nil || e.dest != s.Starved {
+				candidates = append(candidates, i)
+			}
+		}
+	case LIFOSchedule:
+		last := 0
+		for i, e := range q {
+			if e.seq > q[last].seq {
+				last = i
+			}
+		}
+		candidates = []int{last}
+	case ReversePathSchedule:
+		longest := -1
+		for i, e := range q {
+			if l := pathLength(e.m); l > longest {
+				longest, candidates = l, []int{i}
+			} else if l == longest {
+				candidates = append(candidates, i)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = all()
+	}
+
+	return s.pick(q, candidates)
+}
+
+// pick returns a random candidate
+func (s *Scheduler) pick(q eventQueue, candidates []int) int {
+	sort.Slice(candidates, func(i, j int) bool {
+		return q.Less(candidates[i], candidates[j])
+	})
+
+	return candidates[s.r.Intn(len(candidates))]
+}
+
+func longestPath(paths []algo.DolevPath) int {
+	res := 0
+	for _, p := range paths {
+		if len(p.Actual) > res {
+			res = len(p.Actual)
+		}
+	}
+
+	return res
+}
+
+// pathLength returns the length of the longest path travelled by a (Dolev) message, 0 for other messages
+func pathLength(m Message) int {
+	var data brb.Size
+	switch d := m.Data.(type) {
+	case msg.WrapperDataMessage:
+		data = d.Data
+	case msg.LinkData:
+		data = d.Data.Data
+	default:
+		return 0
+	}
+
+	switch d := data.(type) {
+	case brb.DolevMessage:
+		return len(d.Path)
+	case brb.DolevKnownMessage:
+		return len(d.Path.Actual)
+	case brb.DolevUnicastMessage:
+		return len(d.Path.Actual)
+	case brb.DolevKnownImprovedMessage:
+		res := longestPath(d.Paths)
+		if w, ok := d.Payload.(brb.BrachaDolevWrapperMsg); ok {
+			for _, bm := range w.Msgs {
+				if l := longestPath(bm.Paths); l > res {
+					res = l
+				}
+			}
+		}
+
+		return res
+	default:
+		return 0
+	}
+}
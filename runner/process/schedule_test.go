@@ -0,0 +1,128 @@
+package process
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"rp-runner/brb"
+	"rp-runner/msg"
+	"testing"
+	"time"
+)
+
+// recorder keeps the order in which messages are handled by all processes
+type recorder struct {
+	brb.Protocol
+	id  uint64
+	log *[]string
+}
+
+func (r recorder) Receive(messageType uint8, src uint64, uid uint32, data brb.Size) {
+	*r.log = append(*r.log, fmt.Sprintf("%v->%v (%v)", src, r.id, uid))
+	r.Protocol.Receive(messageType, src, uid, data)
+}
+
+// simulate broadcasts a message from every source over a fully connected network of processes running protocol, and
+// returns the order in which the messages were handled. The sources are triggered in the given order and processes
+// send to their neighbours in a random order, like protocols that send in map order do.
+func simulate(t *testing.T, cfg Config, s *Scheduler, sources []uint64, protocol func(id uint64) brb.Protocol) []string {
+	const n = 8
+
+	sim := NewSimulator(cfg.Links)
+	sim.Scheduler = s
+
+	channels := make(map[uint64]chan Message, n)
+	for i := uint64(0); i < n; i++ {
+		channels[i] = nil
+	}
+
+	var log []string
+	ctl := make(chan Message, 1000)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	for i := uint64(0); i < n; i++ {
+		var neighbours []uint64
+		for j := uint64(0); j < n; j++ {
+			if j != i {
+				neighbours = append(neighbours, j)
+			}
+		}
+		rand.Shuffle(len(neighbours), func(a, b int) {
+			neighbours[a], neighbours[b] = neighbours[b], neighbours[a]
+		})
+
+		cfg.Simulator = sim
+		cfg.Seed = int64(i)
+		cfg.ByzConfig = brb.Config{N: n, Id: i, Neighbours: neighbours, Silent: true}
+
+		p, err := StartProcess(i, cfg, stopCh, neighbours, recorder{Protocol: protocol(i), id: i, log: &log}, ctl)
+		require.NoError(t, err)
+
+		p.channels = channels
+		p.brb.Init(p, p, p.cfg.ByzConfig)
+	}
+
+	for _, src := range sources {
+		sim.Inject(src, Message{Ctl: true, Type: msg.TriggerMessageType,
+			Data: msg.TriggerMessage{Id: uint32(src), Payload: testPayload("payload")}})
+	}
+	sim.Run()
+
+	return log
+}
+
+func flooding(uint64) brb.Protocol {
+	return &brb.Flooding{}
+}
+
+func TestSchedulerReplay(t *testing.T) {
+	cfg := Config{Links: UniformLinks{Latency: time.Millisecond}}
+	order := func(seed int64, sources ...uint64) []string {
+		return simulate(t, cfg, NewScheduler(RandomSchedule, 0, 0, seed), sources, flooding)
+	}
+
+	// The schedule only depends on its seed, not on the order in which events were queued
+	first := order(11, 0, 1, 2, 3, 4, 5, 6, 7)
+	require.NotEmpty(t, first)
+	assert.Equal(t, first, order(11, 5, 2, 7, 0, 3, 6, 1, 4))
+	assert.NotEqual(t, first, order(12, 0, 1, 2, 3, 4, 5, 6, 7))
+}
+
+// corrupted runs an adversary from the start
+type corrupted struct {
+	*brb.Corruptible
+	adv brb.Adversary
+}
+
+func (c corrupted) Init(n brb.Network, app brb.Application, cfg brb.Config) {
+	c.Corruptible.Init(n, app, cfg)
+	c.Corrupt(c.adv)
+}
+
+func TestSimulationReplay(t *testing.T) {
+	base := Link{Latency: time.Millisecond, Bandwidth: 10000, Drop: 0.1, Duplicate: 0.1, Reorder: 0.1}
+	protocol := func(id uint64) brb.Protocol {
+		if id == 1 || id == 2 {
+			return corrupted{Corruptible: &brb.Corruptible{Honest: &brb.Flooding{}}, adv: brb.Adversaries["randomDrop"]()}
+		}
+
+		return &brb.Flooding{}
+	}
+	order := func(links LinkModel, sources ...uint64) []string {
+		cfg := Config{Links: links, Reliable: true, RetransmitTimeout: 2 * time.Millisecond}
+		return simulate(t, cfg, NewScheduler(StarveSchedule, 0.5, 3, 11), sources, protocol)
+	}
+
+	// Lossy links, retransmissions, Byzantine processes and the schedule all use their own seed, so a simulation is
+	// replayed exactly
+	links := SpreadLinks{Base: base, Spread: 0.5, Seed: 5}
+	first := order(links, 0, 3, 4, 5)
+	require.NotEmpty(t, first)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, order(links, 5, 4, 3, 0))
+	}
+
+	assert.NotEqual(t, first, order(SpreadLinks{Base: base, Spread: 0.5, Seed: 6}, 0, 3, 4, 5))
+}
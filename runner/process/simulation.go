@@ -0,0 +1,215 @@
+package process
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Link describes a (directed) link between two processes. Messages are transmitted one at a time at Bandwidth bytes
+// per second (0 is unlimited), after which they arrive Latency later. Messages are lost, duplicated or reordered with
+// probability Drop, Duplicate and Reorder.
+type Link struct {
+	Latency   time.Duration
+	Bandwidth float64
+
+	Drop, Duplicate, Reorder float64
+}
+
+// LinkModel determines the link used for messages from src to dest
+type LinkModel interface {
+	Link(src, dest uint64) Link
+}
+
+// UniformLinks uses the same link between all processes
+type UniformLinks Link
+
+func (u UniformLinks) Link(uint64, uint64) Link {
+	return Link(u)
+}
+
+type event struct {
+	at   time.Duration
+	seq  uint64
+	dest uint64
+	m    Message
+
+	// Timers run a function instead of handling a message, they belong to the link from m.Src to dest
+	fn func()
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+
+// Less orders events by time. Simultaneous events are ordered by their link and only then by the order in which they
+// were scheduled, so the order does not depend on the (map) order in which a process sends to different destinations.
+func (q eventQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+
+	switch {
+	case a.at != b.at:
+		return a.at < b.at
+	case (a.fn != nil) != (b.fn != nil):
+		return a.fn != nil
+	case a.dest != b.dest:
+		return a.dest < b.dest
+	case a.m.Src != b.m.Src:
+		return a.m.Src < b.m.Src
+	}
+
+	return a.seq < b.seq
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(event)) }
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Simulator is a discrete-event transport for processes, it replaces the goroutines and channels between processes.
+// All messages are handled one at a time in order of their (virtual) arrival time, which is computed using the link
+// model. Processing time is not modelled, so latencies only depend on the links and the messages sent.
+type Simulator struct {
+	Links LinkModel
+
+	// Picks the next event instead of the event that arrives first if set, the virtual clock never goes back
+	Scheduler *Scheduler
+
+	epoch time.Time
+	now   time.Duration
+	seq   uint64
+	queue eventQueue
+	busy  map[[2]uint64]time.Duration
+	procs map[uint64]*Process
+	lock  sync.Mutex
+
+	// Only a single routine can run the simulation
+	running sync.Mutex
+}
+
+func NewSimulator(links LinkModel) *Simulator {
+	return &Simulator{
+		Links: links,
+		epoch: time.Now(),
+		busy:  make(map[[2]uint64]time.Duration),
+		procs: make(map[uint64]*Process),
+	}
+}
+
+// Now returns the current virtual time
+func (s *Simulator) Now() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.epoch.Add(s.now)
+}
+
+func (s *Simulator) register(p *Process) {
+	s.lock.Lock()
+	s.procs[p.Id] = p
+	s.lock.Unlock()
+}
+
+// must be called while holding lock
+func (s *Simulator) schedule(e event) {
+	e.seq = s.seq
+	heap.Push(&s.queue, e)
+	s.seq += 1
+}
+
+// after runs fn after (virtual) duration d for the link from src to dest
+func (s *Simulator) after(src, dest uint64, d time.Duration, fn func()) {
+	s.lock.Lock()
+	s.schedule(event{at: s.now + d, dest: dest, m: Message{Src: src}, fn: fn})
+	s.lock.Unlock()
+}
+
+// After runs fn after (virtual) duration d, used by the controller
+func (s *Simulator) After(d time.Duration, fn func()) {
+	s.after(0, 0, d, fn)
+}
+
+// Inject schedules a message for process dest at the current virtual time, used by the controller
+func (s *Simulator) Inject(dest uint64, m Message) {
+	s.lock.Lock()
+	s.schedule(event{at: s.now, dest: dest, m: m})
+	s.lock.Unlock()
+}
+
+// transmit schedules the arrival of a message sent over the link from m.Src to dest, a reordered message arrives
+// (additional) delay later than it would normally
+func (s *Simulator) transmit(dest uint64, m Message, delay time.Duration) {
+	l := s.Links.Link(m.Src, dest)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// A link can only transmit one message at a time
+	start := s.now
+	if b := s.busy[[2]uint64{m.Src, dest}]; b > start {
+		start = b
+	}
+
+	end := start
+	if l.Bandwidth > 0 {
+		end += time.Duration(float64(messageSize(m)) / l.Bandwidth * float64(time.Second))
+	}
+	s.busy[[2]uint64{m.Src, dest}] = end
+
+	s.schedule(event{at: end + l.Latency + delay, dest: dest, m: m})
+}
+
+// Run handles messages until no messages are left
+func (s *Simulator) Run() {
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	for {
+		s.lock.Lock()
+		if len(s.queue) == 0 {
+			s.lock.Unlock()
+			return
+		}
+
+		var e event
+		if s.Scheduler != nil {
+			e = heap.Remove(&s.queue, s.Scheduler.next(s.queue)).(event)
+		} else {
+			e = heap.Pop(&s.queue).(event)
+		}
+
+		if e.at > s.now {
+			s.now = e.at
+		}
+		p := s.procs[e.dest]
+		s.lock.Unlock()
+
+		if e.fn != nil {
+			e.fn()
+		} else if p != nil && !p.flushing.Load() && p.verify(e.m) {
+			p.handleMsg(e.m.Src, e.m.Type, e.m.Data, e.m.Ctl)
+		}
+	}
+}
+
+// Idle returns whether no messages are left
+func (s *Simulator) Idle() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.queue) == 0
+}
+
+// Clear drops all messages that have not been handled yet
+func (s *Simulator) Clear() {
+	s.lock.Lock()
+	s.queue = nil
+	s.busy = make(map[[2]uint64]time.Duration)
+	s.lock.Unlock()
+}
@@ -0,0 +1,216 @@
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"rp-runner/brb"
+	"rp-runner/msg"
+	"sync"
+)
+
+// linkBuffer is the amount of messages buffered for every TCP connection to a neighbour
+const linkBuffer = 1024
+
+func init() {
+	gob.Register(wireData{})
+}
+
+// wireData is protocol data in the binary wire format of brb, it replaces the data of messages sent over TCP
+type wireData []byte
+
+func (w wireData) SizeOf() uintptr {
+	return uintptr(len(w))
+}
+
+// toWire encodes the protocol data of a message, data that can not be encoded is sent as is
+func toWire(m Message) Message {
+	switch d := m.Data.(type) {
+	case msg.WrapperDataMessage:
+		if b, err := brb.Encode(d.Data); err == nil {
+			d.Data = wireData(b)
+			m.Data = d
+		}
+	case msg.LinkData:
+		if b, err := brb.Encode(d.Data.Data); err == nil {
+			d.Data.Data = wireData(b)
+			m.Data = d
+		}
+	}
+
+	return m
+}
+
+func fromWire(m Message) (Message, error) {
+	var err error
+
+	switch d := m.Data.(type) {
+	case msg.WrapperDataMessage:
+		if w, ok := d.Data.(wireData); ok {
+			d.Data, err = brb.Decode(w)
+			m.Data = d
+		}
+	case msg.LinkData:
+		if w, ok := d.Data.Data.(wireData); ok {
+			d.Data.Data, err = brb.Decode(w)
+			m.Data = d
+		}
+	}
+
+	return m, err
+}
+
+// TCPEndpoint connects a process to its neighbours over TCP. Every link is a connection per direction, which starts
+// with the id of the sender followed by a gob stream of messages.
+type TCPEndpoint struct {
+	Id uint64
+
+	listener net.Listener
+	inbox    chan Message
+	stopCh   <-chan struct{}
+
+	conns []net.Conn
+	lock  sync.Mutex
+}
+
+// ListenTCP starts accepting connections from neighbours on addr, messages are buffered in a channel of buffer messages
+func ListenTCP(id uint64, addr string, buffer int, stopCh <-chan struct{}) (*TCPEndpoint, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to listen for neighbours")
+	}
+
+	t := &TCPEndpoint{Id: id, listener: l, inbox: make(chan Message, buffer), stopCh: stopCh}
+	go t.accept()
+
+	return t, nil
+}
+
+// Addr returns the address neighbours connect to
+func (t *TCPEndpoint) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// Inbox returns the channel of all messages sent to the process
+func (t *TCPEndpoint) Inbox() chan Message {
+	return t.inbox
+}
+
+// Connect connects to all peers (by id) and returns the channels a process uses to send messages, including its own
+// inbox
+func (t *TCPEndpoint) Connect(peers map[uint64]string) (map[uint64]chan Message, error) {
+	res := map[uint64]chan Message{t.Id: t.inbox}
+
+	for id, addr := range peers {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to connect to %v at %v", id, addr)
+		}
+		t.track(conn)
+
+		var header [8]byte
+		binary.BigEndian.PutUint64(header[:], t.Id)
+		if _, err := conn.Write(header[:]); err != nil {
+			return nil, errors.Wrapf(err, "unable to connect to %v at %v", id, addr)
+		}
+
+		ch := make(chan Message, linkBuffer)
+		res[id] = ch
+		go t.write(id, conn, ch)
+	}
+
+	return res, nil
+}
+
+// Close stops accepting connections and closes all links
+func (t *TCPEndpoint) Close() {
+	_ = t.listener.Close()
+
+	t.lock.Lock()
+	for _, c := range t.conns {
+		_ = c.Close()
+	}
+	t.lock.Unlock()
+}
+
+func (t *TCPEndpoint) track(conn net.Conn) {
+	t.lock.Lock()
+	t.conns = append(t.conns, conn)
+	t.lock.Unlock()
+}
+
+func (t *TCPEndpoint) stopped() bool {
+	select {
+	case <-t.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *TCPEndpoint) accept() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.track(conn)
+
+		go t.read(conn)
+	}
+}
+
+func (t *TCPEndpoint) read(conn net.Conn) {
+	r := bufio.NewReader(conn)
+
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	src := binary.BigEndian.Uint64(header[:])
+
+	dec := gob.NewDecoder(r)
+	for {
+		var m Message
+		if err := dec.Decode(&m); err != nil {
+			if !t.stopped() && err != io.EOF {
+				fmt.Printf("process %v failed to receive message from %v: %v\n", t.Id, src, err)
+			}
+			return
+		}
+
+		m, err := fromWire(m)
+		if err != nil {
+			fmt.Printf("process %v failed to decode message from %v: %v\n", t.Id, src, err)
+			continue
+		}
+
+		select {
+		case t.inbox <- m:
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+func (t *TCPEndpoint) write(dest uint64, conn net.Conn, ch chan Message) {
+	enc := gob.NewEncoder(conn)
+	for {
+		select {
+		case m := <-ch:
+			m = toWire(m)
+			if err := enc.Encode(&m); err != nil {
+				if !t.stopped() {
+					fmt.Printf("process %v failed to send message to %v: %v\n", t.Id, dest, err)
+				}
+				return
+			}
+		case <-t.stopCh:
+			return
+		}
+	}
+}